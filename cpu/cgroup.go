@@ -0,0 +1,404 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//cgroupLevel namespace part for per-cgroup metrics
+	cgroupLevel = "cgroup"
+
+	//cgroupPathTag tag with path of cgroup relative to root of cgroup hierarchy
+	cgroupPathTag = "cgroup_path"
+
+	//cgroupUsage total CPU time consumed by tasks of cgroup, in microseconds
+	cgroupUsage = "usage_usec"
+
+	//cgroupQuota CFS bandwidth quota of cgroup per period, in microseconds
+	cgroupQuota = "quota_usec"
+
+	//cgroupPeriod CFS bandwidth period of cgroup, in microseconds
+	cgroupPeriod = "period_usec"
+
+	//cgroupWeight relative CPU weight of cgroup
+	cgroupWeight = "weight"
+
+	//cgroupUsagePercentage namespace part for CPU usage of cgroup as percentage of host capacity
+	cgroupUsagePercentage = "usage_percentage"
+
+	//cgroupQuotaPercentage namespace part for CPU usage as percentage of quota of cgroup
+	cgroupQuotaPercentage = "quota_percentage"
+
+	//cgroupThrottledRatio namespace part for ratio of throttled periods to all elapsed CFS bandwidth periods of cgroup
+	cgroupThrottledRatio = "throttled_periods_ratio"
+
+	//cgroupThrottledRate namespace part for time for which tasks of cgroup have been throttled per second, in microseconds
+	cgroupThrottledRate = "throttled_usec_rate"
+
+	//cgroupQuotaUtilization namespace part for ratio of CPU time used by cgroup to quota available in elapsed periods
+	cgroupQuotaUtilization = "quota_utilization"
+
+	//cgroupStatFile name of file with CPU usage and throttling statistics of cgroup
+	cgroupStatFile = "cpu.stat"
+
+	//cgroupMaxFile name of file with CFS bandwidth quota and period of cgroup (cgroup v2)
+	cgroupMaxFile = "cpu.max"
+
+	//cgroupWeightFile name of file with CPU weight of cgroup (cgroup v2)
+	cgroupWeightFile = "cpu.weight"
+
+	//mountinfoFile path in procfs of file with mount points of process
+	mountinfoFile = "self/mountinfo"
+)
+
+// DefaultCgroupPath root of cgroup hierarchy
+var DefaultCgroupPath = "/sys/fs/cgroup"
+
+// cgroupStatMetricsNames names of counters read from cpu.stat file of cgroup
+var cgroupStatMetricsNames = []string{cgroupUsage, "user_usec", "system_usec", "nr_periods", "nr_throttled", "throttled_usec"}
+
+// cgroupMetricsNames names of all per-cgroup metrics
+var cgroupMetricsNames = append([]string{cgroupQuota, cgroupPeriod, cgroupWeight, cgroupUsagePercentage, cgroupQuotaPercentage,
+	cgroupThrottledRatio, cgroupThrottledRate, cgroupQuotaUtilization}, cgroupStatMetricsNames...)
+
+// cgroupBandwidthCounters names of cgroup counters kept from previous sample to calculate CFS bandwidth control metrics
+var cgroupBandwidthCounters = []string{cgroupUsage, "nr_periods", "nr_throttled", "throttled_usec"}
+
+// cgroupHierarchy describes cgroup hierarchy with CPU accounting: for cgroup v2 root of unified hierarchy,
+// for cgroup v1 roots of hierarchies with cpuacct and cpu controllers (the same if controllers are mounted together)
+type cgroupHierarchy struct {
+	v1          bool
+	root        string
+	cpuacctRoot string
+	cpuRoot     string
+}
+
+// walkRoot returns root of hierarchy which is walked to find cgroups
+func (h cgroupHierarchy) walkRoot() string {
+	if !h.v1 {
+		return h.root
+	}
+	if h.cpuacctRoot != "" {
+		return h.cpuacctRoot
+	}
+	return h.cpuRoot
+}
+
+// readCgroups walks cgroup hierarchy and reads CPU accounting of every cgroup below its root,
+// CPU usage is reported as percentage of host capacity (all online CPUs) and of CFS bandwidth quota of cgroup,
+// throttling and quota saturation are calculated from differences to previous sample of cgroup
+func (p *CPUCollector) readCgroups(ts time.Time) error {
+	hierarchy, err := getCgroupHierarchy(filepath.Join(p.proc_root, mountinfoFile), p.cgroup_path)
+	if err != nil {
+		return err
+	}
+	cgroups, err := getCgroups(hierarchy, p.clkTck)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// previous samples of counters of cgroups which disappeared are forgotten by the next sample
+	p.cgroupRates.sample(ts)
+	elapsed := p.cgroupRates.elapsed()
+	onlineCPUs := float64(len(p.getOnlineCPUs()))
+	p.cgroupStats = make(map[string]interface{})
+	p.cgroupTags = make(map[string]map[string]string)
+	for path, cgroupStats := range cgroups {
+		diffs := getCgroupDeltas(path, cgroupStats, p.cgroupRates)
+		usagePercentage, quotaPercentage := interface{}(nil), interface{}(nil)
+		if diffUsage, ok := diffs[cgroupUsage]; ok && elapsed > 0 {
+			// rate of microseconds per second is CPU usage in units of 1/1e6 CPU
+			rate := diffUsage / elapsed
+			if onlineCPUs > 0 {
+				usagePercentage = rate / 1e4 / onlineCPUs
+			}
+			quota, hasQuota := cgroupStats[cgroupQuota].(uint64)
+			period, _ := cgroupStats[cgroupPeriod].(uint64)
+			if hasQuota && quota > 0 {
+				quotaPercentage = rate / 1e4 * float64(period) / float64(quota)
+			}
+		}
+		cgroupStats[cgroupUsagePercentage] = usagePercentage
+		cgroupStats[cgroupQuotaPercentage] = quotaPercentage
+		getCgroupBandwidthStats(cgroupStats, diffs, elapsed)
+
+		name := getCgroupName(path)
+		p.cgroupStats[name] = cgroupStats
+		p.cgroupTags[name] = map[string]string{cgroupPathTag: path}
+	}
+	return nil
+}
+
+// getCgroupDeltas stores counters of cgroup with given path listed in cgroupBandwidthCounters in rates
+// and returns their differences to previous sample, counters without previous sample or which went down are omitted
+func getCgroupDeltas(path string, cgroupStats map[string]interface{}, rates *rateTracker) map[string]float64 {
+	diffs := make(map[string]float64)
+	for _, counter := range cgroupBandwidthCounters {
+		val, ok := cgroupStats[counter].(uint64)
+		if !ok {
+			continue
+		}
+		if diff, ok := rates.delta(getCgroupCounterKey(path, counter), float64(val)); ok {
+			diffs[counter] = diff
+		}
+	}
+	return diffs
+}
+
+// getCgroupBandwidthStats calculates CFS bandwidth control metrics of cgroup from differences of its counters
+// to previous sample taken elapsed seconds ago and adds them to cgroupStats: ratio of throttled periods,
+// throttled time per second and quota utilization (usage divided by quota available in elapsed periods); metrics are nil
+// for the first sample, when counters went down and when no period has elapsed
+func getCgroupBandwidthStats(cgroupStats map[string]interface{}, diffs map[string]float64, elapsed float64) {
+	cgroupStats[cgroupThrottledRatio] = nil
+	cgroupStats[cgroupThrottledRate] = nil
+	cgroupStats[cgroupQuotaUtilization] = nil
+	if diffPeriods, ok := diffs["nr_periods"]; ok && diffPeriods > 0 {
+		if diffThrottled, ok := diffs["nr_throttled"]; ok {
+			cgroupStats[cgroupThrottledRatio] = diffThrottled / diffPeriods
+		}
+		quota, hasQuota := cgroupStats[cgroupQuota].(uint64)
+		if diffUsage, ok := diffs[cgroupUsage]; ok && hasQuota && quota > 0 {
+			cgroupStats[cgroupQuotaUtilization] = diffUsage / (float64(quota) * diffPeriods)
+		}
+	}
+	if diffThrottledTime, ok := diffs["throttled_usec"]; ok && elapsed > 0 {
+		cgroupStats[cgroupThrottledRate] = diffThrottledTime / elapsed
+	}
+}
+
+// getCgroupCounterKey returns key of counter of cgroup with given path in previous samples (e.g. user.slice/nr_periods),
+// names of counters do not contain "/", so keys of different cgroups do not collide
+func getCgroupCounterKey(path string, counter string) string {
+	return path + "/" + counter
+}
+
+// getCgroupName converts path of cgroup to namespace element, "/" is not allowed in namespace element
+// so it is replaced with ":" (e.g. kubepods.slice/pod1 is reported as kubepods.slice:pod1)
+func getCgroupName(path string) string {
+	return strings.Replace(path, "/", ":", -1)
+}
+
+// getCgroups walks cgroup hierarchy and reads CPU accounting of every cgroup below its root,
+// returns map of per-cgroup metrics with path relative to root as key; cgroups which disappear during the walk
+// and unreadable cgroups (with their subtrees) are omitted,
+// clkTck is frequency of clock ticks in which cgroup v1 reports user and system time
+func getCgroups(hierarchy cgroupHierarchy, clkTck float64) (map[string]map[string]interface{}, error) {
+	root := hierarchy.walkRoot()
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	cgroups := make(map[string]map[string]interface{})
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			// cgroup removed during the walk or unreadable subtree (e.g. delegated to another user) is skipped
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || dir == root {
+			return nil
+		}
+		path, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		var cgroupStats map[string]interface{}
+		if hierarchy.v1 {
+			cgroupStats, err = getCgroupV1(hierarchy, path, clkTck)
+		} else {
+			cgroupStats, err = getCgroupV2(dir)
+		}
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		cgroups[path] = cgroupStats
+		return nil
+	})
+	return cgroups, err
+}
+
+/* getCgroupHierarchy parses mountinfo file of process to detect cgroup version:
+30 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate
+35 25 0:31 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,cpu,cpuacct
+cgroup v1 is used if cpuacct or cpu controller is mounted as cgroup v1 (legacy or hybrid hierarchy),
+cgroup v2 otherwise; mount points below default root of cgroup hierarchy are moved below root given in cgroupPath,
+so hierarchy of host mounted inside a container can be used. If mountinfo is not available, cgroup v2 hierarchy
+with root in cgroupPath is assumed
+*/
+func getCgroupHierarchy(mountinfoPath string, cgroupPath string) (cgroupHierarchy, error) {
+	hierarchy := cgroupHierarchy{root: cgroupPath}
+	fh, err := os.Open(mountinfoPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hierarchy, nil
+		}
+		return hierarchy, err
+	}
+	defer fh.Close()
+
+	v2Found := false
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// optional fields are terminated with separator, followed by filesystem type, source and super options
+		sep := 0
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep == 0 || sep+3 >= len(fields) {
+			continue
+		}
+		mountPoint := getCgroupMountPoint(fields[4], cgroupPath)
+		switch fields[sep+1] {
+		case "cgroup2":
+			// unified hierarchy at the root is preferred to one mounted below root (hybrid hierarchy)
+			if !v2Found || mountPoint == cgroupPath {
+				hierarchy.root = mountPoint
+				v2Found = true
+			}
+		case "cgroup":
+			for _, option := range strings.Split(fields[sep+3], ",") {
+				if option == "cpuacct" && hierarchy.cpuacctRoot == "" {
+					hierarchy.cpuacctRoot = mountPoint
+				} else if option == "cpu" && hierarchy.cpuRoot == "" {
+					hierarchy.cpuRoot = mountPoint
+				}
+			}
+		}
+	}
+	hierarchy.v1 = hierarchy.cpuacctRoot != "" || hierarchy.cpuRoot != ""
+	return hierarchy, scanner.Err()
+}
+
+// getCgroupMountPoint moves mount point below default root of cgroup hierarchy to given root of cgroup hierarchy
+func getCgroupMountPoint(mountPoint string, cgroupPath string) string {
+	if mountPoint == DefaultCgroupPath {
+		return cgroupPath
+	}
+	if strings.HasPrefix(mountPoint, DefaultCgroupPath+"/") {
+		return filepath.Join(cgroupPath, strings.TrimPrefix(mountPoint, DefaultCgroupPath))
+	}
+	return mountPoint
+}
+
+// getCgroupV2 reads CPU usage and throttling counters, CFS bandwidth quota and period and CPU weight of cgroup v2;
+// quota is omitted if it is not set (max), throttling counters, quota, period and weight are omitted
+// if cpu controller is not enabled for cgroup
+func getCgroupV2(dir string) (map[string]interface{}, error) {
+	stat, err := getCgroupCounters(filepath.Join(dir, cgroupStatFile))
+	if err != nil {
+		return nil, err
+	}
+	cgroupStats := make(map[string]interface{})
+	for _, metricName := range cgroupStatMetricsNames {
+		if val, ok := stat[metricName]; ok {
+			cgroupStats[metricName] = val
+		}
+	}
+
+	max, err := readStringFile(filepath.Join(dir, cgroupMaxFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		fields := strings.Fields(max)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Wrong %s format", filepath.Join(dir, cgroupMaxFile))
+		}
+		if fields[0] != "max" {
+			quota, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			cgroupStats[cgroupQuota] = quota
+		}
+		period, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		cgroupStats[cgroupPeriod] = period
+	}
+
+	weight, err := readUintFile(filepath.Join(dir, cgroupWeightFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		cgroupStats[cgroupWeight] = weight
+	}
+	return cgroupStats, nil
+}
+
+/* getCgroupCounters parses flat keyed file of cgroup (e.g. cpu.stat, cpuacct.stat):
+usage_usec 1286215
+user_usec 901243
+...
+returns map of counters with name as key
+*/
+func getCgroupCounters(path string) (map[string]uint64, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		counters[fields[0]] = val
+	}
+	return counters, scanner.Err()
+}
@@ -0,0 +1,230 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockCgroupFile writes file with given path relative to mocked cgroup root
+func loadMockCgroupFile(path string, content string) {
+	path = filepath.Join(mockCgroupRoot, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
+
+// loadMockCgroupV2 writes mocked cgroup v2 hierarchy with pod cgroup which used given CPU time (in microseconds)
+func loadMockCgroupV2(podUsage string) {
+	loadMockCgroupFile(cgroupStatFile, "usage_usec 900000000\nuser_usec 600000000\nsystem_usec 300000000\n")
+	loadMockCgroupFile("kubepods.slice/"+cgroupStatFile, "usage_usec 50000000\nuser_usec 30000000\nsystem_usec 20000000\n"+
+		"nr_periods 0\nnr_throttled 0\nthrottled_usec 0\n")
+	loadMockCgroupFile("kubepods.slice/"+cgroupMaxFile, "max 100000\n")
+	loadMockCgroupFile("kubepods.slice/"+cgroupWeightFile, "100\n")
+	loadMockCgroupFile("kubepods.slice/pod1/"+cgroupStatFile, "usage_usec "+podUsage+"\nuser_usec 1000\nsystem_usec 2000\n"+
+		"nr_periods 50\nnr_throttled 5\nthrottled_usec 120000\nnr_bursts 0\nburst_usec 0\n")
+	loadMockCgroupFile("kubepods.slice/pod1/"+cgroupMaxFile, "200000 100000\n")
+	loadMockCgroupFile("kubepods.slice/pod1/"+cgroupWeightFile, "50\n")
+	loadMockCgroupFile("user.slice/"+cgroupStatFile, "usage_usec 7000\nuser_usec 5000\nsystem_usec 2000\n")
+}
+
+func (cis *CPUInfoSuite) TestCgroups() {
+	Convey("Given cpu plugin initialized with mocked cgroup v2 hierarchy", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockCgroupV2("3000")
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readCgroups(ts), ShouldBeNil)
+
+		Convey("every cgroup below root should be read", func() {
+			So(len(p.cgroupStats), ShouldEqual, 3)
+			So(p.cgroupStats, ShouldContainKey, "kubepods.slice")
+			So(p.cgroupStats, ShouldContainKey, "kubepods.slice:pod1")
+			So(p.cgroupStats, ShouldContainKey, "user.slice")
+			So(p.cgroupTags["kubepods.slice:pod1"][cgroupPathTag], ShouldEqual, "kubepods.slice/pod1")
+		})
+
+		Convey("counters, quota, period and weight should be read", func() {
+			pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+			So(pod[cgroupUsage], ShouldEqual, 3000)
+			So(pod["nr_throttled"], ShouldEqual, 5)
+			So(pod["throttled_usec"], ShouldEqual, 120000)
+			So(pod[cgroupQuota], ShouldEqual, 200000)
+			So(pod[cgroupPeriod], ShouldEqual, 100000)
+			So(pod[cgroupWeight], ShouldEqual, 50)
+			So(pod, ShouldNotContainKey, "nr_bursts")
+			So(pod[cgroupUsagePercentage], ShouldBeNil)
+
+			slice := p.cgroupStats["kubepods.slice"].(map[string]interface{})
+			So(slice, ShouldNotContainKey, cgroupQuota)
+			So(slice[cgroupPeriod], ShouldEqual, 100000)
+
+			user := p.cgroupStats["user.slice"].(map[string]interface{})
+			So(user, ShouldNotContainKey, cgroupPeriod)
+			So(user, ShouldNotContainKey, "nr_periods")
+		})
+
+		Convey("usage should be calculated as percentage of host capacity and of quota", func() {
+			// one CPU used for 10 seconds out of 4 online CPUs and quota of 2 CPUs
+			loadMockCgroupV2("10003000")
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+			pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+			So(pod[cgroupUsagePercentage], ShouldAlmostEqual, 25)
+			So(pod[cgroupQuotaPercentage], ShouldAlmostEqual, 50)
+
+			slice := p.cgroupStats["kubepods.slice"].(map[string]interface{})
+			So(slice[cgroupUsagePercentage], ShouldEqual, 0)
+			So(slice[cgroupQuotaPercentage], ShouldBeNil)
+		})
+
+		Convey("per-cgroup metrics should be collected with cgroup path tag", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, cgroupLevel, "*", cgroupWeight)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			for _, m := range metrics {
+				So(m.Tags[cgroupPathTag], ShouldEqual, map[string]string{
+					"kubepods.slice":      "kubepods.slice",
+					"kubepods.slice:pod1": "kubepods.slice/pod1",
+				}[m.Namespace.Strings()[4]])
+			}
+		})
+
+		Convey("unreadable cgroup subtree should be skipped", func() {
+			if os.Geteuid() == 0 {
+				// permissions are not enforced for root
+				return
+			}
+			So(os.Chmod(filepath.Join(mockCgroupRoot, "kubepods.slice"), 0), ShouldBeNil)
+			defer os.Chmod(filepath.Join(mockCgroupRoot, "kubepods.slice"), 0755)
+			So(p.readCgroups(time.Now()), ShouldBeNil)
+			So(p.cgroupStats, ShouldContainKey, "user.slice")
+			So(p.cgroupStats, ShouldNotContainKey, "kubepods.slice:pod1")
+		})
+
+		Convey("missing cgroup hierarchy should be skipped", func() {
+			os.RemoveAll(mockCgroupRoot)
+			So(p.readCgroups(ts), ShouldBeNil)
+		})
+
+		Convey("incorrect cpu.max should return error", func() {
+			loadMockCgroupFile("user.slice/"+cgroupMaxFile, "100000\n")
+			So(p.readCgroups(ts), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockCgroupRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCgroupBandwidth() {
+	Convey("Given cpu plugin initialized with mocked cgroup v2 hierarchy", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockCgroupV2("3000")
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readCgroups(ts), ShouldBeNil)
+
+		Convey("throttling metrics should not be available for the first sample", func() {
+			pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+			So(pod, ShouldContainKey, cgroupThrottledRatio)
+			So(pod[cgroupThrottledRatio], ShouldBeNil)
+			So(pod[cgroupThrottledRate], ShouldBeNil)
+			So(pod[cgroupQuotaUtilization], ShouldBeNil)
+			So(p.cgroupRates.prev[getCgroupCounterKey("kubepods.slice/pod1", "nr_throttled")], ShouldEqual, 5)
+			So(p.prevMetricsSum, ShouldNotContainKey, getCgroupCounterKey("kubepods.slice/pod1", "nr_throttled"))
+		})
+
+		Convey("throttling metrics should be calculated from differences to previous sample", func() {
+			loadMockCgroupFile("kubepods.slice/pod1/"+cgroupStatFile, "usage_usec 10003000\nuser_usec 1000\nsystem_usec 2000\n"+
+				"nr_periods 150\nnr_throttled 25\nthrottled_usec 620000\n")
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+
+			pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+			So(pod[cgroupThrottledRatio], ShouldAlmostEqual, 0.2)
+			So(pod[cgroupThrottledRate], ShouldAlmostEqual, 50000)
+			So(pod[cgroupQuotaUtilization], ShouldAlmostEqual, 0.5)
+
+			Convey("ratios should not be available when no period has elapsed", func() {
+				So(p.readCgroups(ts.Add(20*time.Second)), ShouldBeNil)
+				pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+				So(pod[cgroupThrottledRatio], ShouldBeNil)
+				So(pod[cgroupQuotaUtilization], ShouldBeNil)
+				So(pod[cgroupThrottledRate], ShouldEqual, 0)
+			})
+		})
+
+		Convey("quota utilization should not be available for cgroup without quota", func() {
+			loadMockCgroupFile("kubepods.slice/"+cgroupStatFile, "usage_usec 60000000\nuser_usec 30000000\nsystem_usec 20000000\n"+
+				"nr_periods 10\nnr_throttled 0\nthrottled_usec 0\n")
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+			slice := p.cgroupStats["kubepods.slice"].(map[string]interface{})
+			So(slice[cgroupThrottledRatio], ShouldEqual, 0)
+			So(slice[cgroupQuotaUtilization], ShouldBeNil)
+		})
+
+		Convey("throttling metrics should not be available after counters went down", func() {
+			loadMockCgroupFile("kubepods.slice/pod1/"+cgroupStatFile, "usage_usec 1000\nuser_usec 500\nsystem_usec 500\n"+
+				"nr_periods 10\nnr_throttled 1\nthrottled_usec 100\n")
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+			pod := p.cgroupStats["kubepods.slice:pod1"].(map[string]interface{})
+			So(pod[cgroupThrottledRatio], ShouldBeNil)
+			So(pod[cgroupThrottledRate], ShouldBeNil)
+			So(pod[cgroupQuotaUtilization], ShouldBeNil)
+		})
+
+		Convey("previous samples of removed cgroups should be dropped", func() {
+			os.RemoveAll(filepath.Join(mockCgroupRoot, "user.slice"))
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+			So(p.readCgroups(ts.Add(20*time.Second)), ShouldBeNil)
+			So(p.cgroupRates.prev, ShouldNotContainKey, getCgroupCounterKey("user.slice", cgroupUsage))
+			So(p.cgroupRates.prev, ShouldContainKey, getCgroupCounterKey("kubepods.slice/pod1", "nr_periods"))
+		})
+
+		Convey("previous samples should be kept when counters of CPUs are reset", func() {
+			loadMockCPUInfo(1)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+			loadMockCPUInfo(2)
+			So(p.readProcStat(ts.Add(20*time.Second)), ShouldBeNil)
+			So(p.stats[secondCPU][counterResetMetric], ShouldEqual, 1)
+			So(p.cgroupRates.prev, ShouldContainKey, getCgroupCounterKey("kubepods.slice/pod1", "nr_periods"))
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockCgroupRoot)
+		})
+	})
+}
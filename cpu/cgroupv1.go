@@ -0,0 +1,182 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//cgroupPercpu namespace part for per-CPU usage of cgroup (cgroup v1 only)
+	cgroupPercpu = "percpu"
+
+	//cpuacctUsageFile name of file with total CPU time consumed by tasks of cgroup in nanoseconds (cgroup v1)
+	cpuacctUsageFile = "cpuacct.usage"
+
+	//cpuacctUsagePercpuFile name of file with per-CPU CPU time consumed by tasks of cgroup in nanoseconds (cgroup v1)
+	cpuacctUsagePercpuFile = "cpuacct.usage_percpu"
+
+	//cpuacctStatFile name of file with user and system CPU time of cgroup in USER_HZ units (cgroup v1)
+	cpuacctStatFile = "cpuacct.stat"
+
+	//cfsQuotaFile name of file with CFS bandwidth quota of cgroup in microseconds, -1 if not set (cgroup v1)
+	cfsQuotaFile = "cpu.cfs_quota_us"
+
+	//cfsPeriodFile name of file with CFS bandwidth period of cgroup in microseconds (cgroup v1)
+	cfsPeriodFile = "cpu.cfs_period_us"
+
+	//cpuSharesFile name of file with relative CPU shares of cgroup (cgroup v1)
+	cpuSharesFile = "cpu.shares"
+)
+
+// getCgroupV1 reads CPU accounting of cgroup with given path relative to roots of cpuacct and cpu controller
+// hierarchies of cgroup v1 and converts it to cgroup v2 metrics: usage and throttled time are converted to microseconds,
+// CPU shares are converted to weight; per-CPU usage is available only for cgroup v1
+func getCgroupV1(hierarchy cgroupHierarchy, path string, clkTck float64) (map[string]interface{}, error) {
+	if _, err := os.Stat(filepath.Join(hierarchy.walkRoot(), path)); err != nil {
+		return nil, err
+	}
+
+	cgroupStats := make(map[string]interface{})
+	if hierarchy.cpuacctRoot != "" {
+		if err := getCpuacct(filepath.Join(hierarchy.cpuacctRoot, path), cgroupStats, clkTck); err != nil {
+			return nil, err
+		}
+	}
+	if hierarchy.cpuRoot != "" {
+		if err := getCPUController(filepath.Join(hierarchy.cpuRoot, path), cgroupStats); err != nil {
+			return nil, err
+		}
+	}
+	return cgroupStats, nil
+}
+
+// getCpuacct reads total, per-CPU, user and system CPU time of cgroup v1 from cpuacct controller directory,
+// times are converted to microseconds (user and system time using frequency of clock ticks); missing files are omitted
+func getCpuacct(dir string, cgroupStats map[string]interface{}, clkTck float64) error {
+	usage, err := readUintFile(filepath.Join(dir, cpuacctUsageFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		cgroupStats[cgroupUsage] = usage / 1000
+	}
+
+	percpu, err := getCpuacctUsagePercpu(filepath.Join(dir, cpuacctUsagePercpuFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		cgroupStats[cgroupPercpu] = percpu
+	}
+
+	stat, err := getCgroupCounters(filepath.Join(dir, cpuacctStatFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, name := range []string{"user", "system"} {
+		if val, ok := stat[name]; ok {
+			cgroupStats[name+"_usec"] = uint64(float64(val) * 1000000 / clkTck)
+		}
+	}
+	return nil
+}
+
+// getCPUController reads throttling counters, CFS bandwidth quota and period and CPU shares of cgroup v1
+// from cpu controller directory; throttled time is converted to microseconds, shares are converted to weight,
+// quota is omitted if it is not set (-1), missing files are omitted
+func getCPUController(dir string, cgroupStats map[string]interface{}) error {
+	stat, err := getCgroupCounters(filepath.Join(dir, cgroupStatFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for name, val := range stat {
+		switch name {
+		case "nr_periods", "nr_throttled":
+			cgroupStats[name] = val
+		case "throttled_time":
+			cgroupStats["throttled_usec"] = val / 1000
+		}
+	}
+
+	quota, err := readStringFile(filepath.Join(dir, cfsQuotaFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && quota != "-1" {
+		val, err := strconv.ParseUint(quota, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Wrong %s format", filepath.Join(dir, cfsQuotaFile))
+		}
+		cgroupStats[cgroupQuota] = val
+	}
+	period, err := readUintFile(filepath.Join(dir, cfsPeriodFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		cgroupStats[cgroupPeriod] = period
+	}
+	shares, err := readUintFile(filepath.Join(dir, cpuSharesFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		cgroupStats[cgroupWeight] = sharesToWeight(shares)
+	}
+	return nil
+}
+
+// sharesToWeight converts CPU shares of cgroup v1 (2-262144) to CPU weight of cgroup v2 (1-10000)
+// in the same way as container runtimes do it
+func sharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	} else if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+/* getCpuacctUsagePercpu parses cpuacct.usage_percpu file of cgroup v1:
+45120954 70321546 38753200 41127542
+returns map of CPU time consumed by tasks of cgroup on each CPU in microseconds with CPU identifier as key
+*/
+func getCpuacctUsagePercpu(path string) (map[string]interface{}, error) {
+	content, err := readStringFile(path)
+	if err != nil {
+		return nil, err
+	}
+	percpu := make(map[string]interface{})
+	for cpuID, field := range strings.Fields(content) {
+		val, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		percpu[strconv.Itoa(cpuID)] = map[string]interface{}{cgroupUsage: val / 1000}
+	}
+	return percpu, nil
+}
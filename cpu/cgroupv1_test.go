@@ -0,0 +1,177 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	//mountinfoV2 mountinfo of host with unified cgroup v2 hierarchy
+	mountinfoV2 = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate`
+
+	//mountinfoHybrid mountinfo of host with hybrid hierarchy, cpu and cpuacct controllers mounted together as cgroup v1
+	mountinfoHybrid = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+25 24 0:23 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:3 - tmpfs tmpfs ro,mode=755
+26 25 0:24 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate
+35 25 0:31 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,cpu,cpuacct
+36 25 0:32 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:13 - cgroup cgroup rw,memory`
+
+	//mountinfoSeparate mountinfo of host with cpu and cpuacct controllers mounted separately as cgroup v1
+	mountinfoSeparate = `25 24 0:23 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:3 - tmpfs tmpfs ro,mode=755
+35 25 0:31 / /sys/fs/cgroup/cpu rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,cpu
+36 25 0:32 / /sys/fs/cgroup/cpuacct rw,nosuid,nodev,noexec,relatime shared:13 - cgroup cgroup rw,cpuacct`
+)
+
+// loadMockCgroupV1 writes mocked cgroup v1 hierarchy with cpu and cpuacct controllers mounted together,
+// container cgroup used given CPU time (in nanoseconds)
+func loadMockCgroupV1(usage string) {
+	loadMockProcFile(mountinfoFile, mountinfoHybrid)
+	dir := "cpu,cpuacct/docker/abc/"
+	loadMockCgroupFile("cpu,cpuacct/"+cpuacctUsageFile, "900000000000\n")
+	loadMockCgroupFile(dir+cpuacctUsageFile, usage+"\n")
+	loadMockCgroupFile(dir+cpuacctUsagePercpuFile, "1000000 2000000 0 0 \n")
+	loadMockCgroupFile(dir+cpuacctStatFile, "user 10\nsystem 5\n")
+	loadMockCgroupFile(dir+cgroupStatFile, "nr_periods 50\nnr_throttled 5\nthrottled_time 120000000\n")
+	loadMockCgroupFile(dir+cfsQuotaFile, "200000\n")
+	loadMockCgroupFile(dir+cfsPeriodFile, "100000\n")
+	loadMockCgroupFile(dir+cpuSharesFile, "1024\n")
+	loadMockCgroupFile("cpu,cpuacct/docker/"+cfsQuotaFile, "-1\n")
+	loadMockCgroupFile("cpu,cpuacct/docker/"+cpuacctUsageFile, "5000000\n")
+}
+
+func (cis *CPUInfoSuite) TestGetCgroupHierarchy() {
+	Convey("Given mountinfo of process", cis.T(), func() {
+		path := filepath.Join(mockProcRoot, mountinfoFile)
+
+		Convey("cgroup v2 should be detected for unified hierarchy", func() {
+			loadMockProcFile(mountinfoFile, mountinfoV2)
+			hierarchy, err := getCgroupHierarchy(path, "/hostcgroup")
+			So(err, ShouldBeNil)
+			So(hierarchy.v1, ShouldBeFalse)
+			So(hierarchy.walkRoot(), ShouldEqual, "/hostcgroup")
+		})
+
+		Convey("cgroup v1 should be detected for hybrid hierarchy", func() {
+			loadMockProcFile(mountinfoFile, mountinfoHybrid)
+			hierarchy, err := getCgroupHierarchy(path, DefaultCgroupPath)
+			So(err, ShouldBeNil)
+			So(hierarchy.v1, ShouldBeTrue)
+			So(hierarchy.cpuacctRoot, ShouldEqual, "/sys/fs/cgroup/cpu,cpuacct")
+			So(hierarchy.cpuRoot, ShouldEqual, "/sys/fs/cgroup/cpu,cpuacct")
+		})
+
+		Convey("separately mounted cpu and cpuacct controllers should be detected", func() {
+			loadMockProcFile(mountinfoFile, mountinfoSeparate)
+			hierarchy, err := getCgroupHierarchy(path, "/hostcgroup")
+			So(err, ShouldBeNil)
+			So(hierarchy.v1, ShouldBeTrue)
+			So(hierarchy.cpuacctRoot, ShouldEqual, "/hostcgroup/cpuacct")
+			So(hierarchy.cpuRoot, ShouldEqual, "/hostcgroup/cpu")
+			So(hierarchy.walkRoot(), ShouldEqual, "/hostcgroup/cpuacct")
+		})
+
+		Convey("cgroup v2 should be assumed without mountinfo", func() {
+			hierarchy, err := getCgroupHierarchy(path, DefaultCgroupPath)
+			So(err, ShouldBeNil)
+			So(hierarchy.v1, ShouldBeFalse)
+			So(hierarchy.walkRoot(), ShouldEqual, DefaultCgroupPath)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCgroupsV1() {
+	Convey("Given cpu plugin initialized with mocked cgroup v1 hierarchy", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockCgroupV1("3000000")
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readCgroups(ts), ShouldBeNil)
+
+		Convey("cgroup v1 accounting should be published with cgroup v2 metric names", func() {
+			So(len(p.cgroupStats), ShouldEqual, 2)
+			cgroup := p.cgroupStats["docker:abc"].(map[string]interface{})
+			So(cgroup[cgroupUsage], ShouldEqual, 3000)
+			So(cgroup["user_usec"], ShouldEqual, 100000)
+			So(cgroup["system_usec"], ShouldEqual, 50000)
+			So(cgroup["nr_periods"], ShouldEqual, 50)
+			So(cgroup["nr_throttled"], ShouldEqual, 5)
+			So(cgroup["throttled_usec"], ShouldEqual, 120000)
+			So(cgroup[cgroupQuota], ShouldEqual, 200000)
+			So(cgroup[cgroupPeriod], ShouldEqual, 100000)
+			So(cgroup[cgroupWeight], ShouldEqual, 39)
+
+			val, err := getMapValueByNamespace(cgroup, []string{cgroupPercpu, secondCPU, cgroupUsage})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 2000)
+
+			So(p.cgroupStats["docker"], ShouldNotContainKey, cgroupQuota)
+		})
+
+		Convey("usage should be calculated as percentage of host capacity and of quota", func() {
+			// one CPU used for 10 seconds out of 4 online CPUs and quota of 2 CPUs
+			loadMockCgroupV1("10003000000")
+			So(p.readCgroups(ts.Add(10*time.Second)), ShouldBeNil)
+			cgroup := p.cgroupStats["docker:abc"].(map[string]interface{})
+			So(cgroup[cgroupUsagePercentage], ShouldAlmostEqual, 25)
+			So(cgroup[cgroupQuotaPercentage], ShouldAlmostEqual, 50)
+		})
+
+		Convey("per-CPU usage of cgroup should be collected", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, cgroupLevel, "docker:abc", cgroupPercpu, "*", cgroupUsage)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 4)
+			for _, m := range metrics {
+				So(m.Tags[cgroupPathTag], ShouldEqual, "docker/abc")
+			}
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+			os.RemoveAll(mockCgroupRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestSharesToWeight() {
+	Convey("CPU shares should be converted to weight", cis.T(), func() {
+		So(sharesToWeight(2), ShouldEqual, 1)
+		So(sharesToWeight(1024), ShouldEqual, 39)
+		So(sharesToWeight(262144), ShouldEqual, 10000)
+		So(sharesToWeight(0), ShouldEqual, 1)
+		So(sharesToWeight(1000000), ShouldEqual, 10000)
+	})
+}
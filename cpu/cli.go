@@ -0,0 +1,164 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//FormatJSON output format with JSON array of metrics
+	FormatJSON = "json"
+
+	//FormatCSV output format with CSV line per metric
+	FormatCSV = "csv"
+
+	//FormatTable output format with aligned table
+	FormatTable = "table"
+)
+
+// cliMetric metric printed by one-shot CLI mode
+type cliMetric struct {
+	Namespace string            `json:"namespace"`
+	Data      interface{}       `json:"data"`
+	Unit      string            `json:"unit,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// CollectOnce collects all available metrics twice with given interval between collections, so rates and percentages
+// are available, and returns metrics of the second collection which namespace matches any of given globs
+// (e.g. /intel/procfs/cpu/*/user_percentage), all metrics are returned if no glob is given; globs and output format
+// in which metrics are going to be written are checked before collection
+func CollectOnce(collector *CPUCollector, cfg plugin.Config, interval time.Duration, globs []string, format string) ([]plugin.Metric, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("Incorrect namespace glob %s: %v", glob, err)
+		}
+	}
+	mts, err := collector.GetMetricTypes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range mts {
+		mts[i].Config = cfg
+	}
+	if _, err := collector.CollectMetrics(mts); err != nil {
+		return nil, err
+	}
+	time.Sleep(interval)
+	metrics, err := collector.CollectMetrics(mts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(globs) == 0 {
+		return metrics, nil
+	}
+	filtered := []plugin.Metric{}
+	for _, m := range metrics {
+		for _, glob := range globs {
+			if matched, _ := path.Match(glob, m.Namespace.String()); matched {
+				filtered = append(filtered, m)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// WriteMetrics writes metrics sorted by namespace to w in given format (json, csv or table)
+func WriteMetrics(w io.Writer, metrics []plugin.Metric, format string) error {
+	cliMetrics := make([]cliMetric, 0, len(metrics))
+	for _, m := range metrics {
+		cliMetrics = append(cliMetrics, cliMetric{
+			Namespace: m.Namespace.String(),
+			Data:      m.Data,
+			Unit:      m.Unit,
+			Tags:      m.Tags,
+			Timestamp: m.Timestamp,
+		})
+	}
+	sort.Sort(byNamespace(cliMetrics))
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cliMetrics)
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"namespace", "data", "unit", "tags", "timestamp"})
+		for _, m := range cliMetrics {
+			writer.Write([]string{m.Namespace, fmt.Sprint(m.Data), m.Unit, formatTags(m.Tags), m.Timestamp.Format(time.RFC3339Nano)})
+		}
+		writer.Flush()
+		return writer.Error()
+	case FormatTable:
+		writer := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAMESPACE\tDATA\tUNIT\tTAGS")
+		for _, m := range cliMetrics {
+			fmt.Fprintf(writer, "%s\t%v\t%s\t%s\n", m.Namespace, m.Data, m.Unit, formatTags(m.Tags))
+		}
+		return writer.Flush()
+	}
+	return checkFormat(format)
+}
+
+// checkFormat returns error if given output format is not supported
+func checkFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatCSV, FormatTable:
+		return nil
+	}
+	return fmt.Errorf("Unknown output format %s", format)
+}
+
+// formatTags formats tags as comma separated list of key=value pairs sorted by key
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, val := range tags {
+		pairs = append(pairs, key+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// byNamespace sorts metrics printed by one-shot CLI mode by namespace
+type byNamespace []cliMetric
+
+func (s byNamespace) Len() int           { return len(s) }
+func (s byNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNamespace) Less(i, j int) bool { return s[i].Namespace < s[j].Namespace }
@@ -0,0 +1,117 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestCollectOnce() {
+	Convey("Given cpu plugin with mocked /proc/stat", cis.T(), func() {
+		loadMockCPUInfo(0)
+		content, err := ioutil.ReadFile(mockPath)
+		So(err, ShouldBeNil)
+		loadMockProcFile("stat", string(content))
+		cfg := plugin.Config{"proc_path": mockProcRoot, "sys_path": mockSysRoot, "cgroup_path": mockCgroupRoot}
+
+		Convey("metrics matching namespace globs should be returned", func() {
+			metrics, err := CollectOnce(New(), cfg, time.Millisecond, []string{"/intel/procfs/cpu/*/user_jiffies", "/intel/procfs/cpu/system/ctxt"}, FormatJSON)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 6)
+		})
+
+		Convey("all metrics should be returned without globs", func() {
+			metrics, err := CollectOnce(New(), cfg, time.Millisecond, nil, FormatTable)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldBeGreaterThan, 6)
+		})
+
+		Convey("incorrect glob should return error", func() {
+			_, err := CollectOnce(New(), cfg, time.Millisecond, []string{"/intel/procfs/cpu/[/user_jiffies"}, FormatTable)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("unknown format should return error before collection", func() {
+			start := time.Now()
+			_, err := CollectOnce(New(), cfg, time.Hour, nil, "xml")
+			So(err, ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Minute)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestWriteMetrics() {
+	Convey("Given collected metrics", cis.T(), func() {
+		ts := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+		metrics := []plugin.Metric{
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, secondCPU, "user_jiffies"), Data: 12.5, Unit: "jiffies", Timestamp: ts,
+				Tags: map[string]string{socketIDTag: "0", coreIDTag: "1"}},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, allCPU, "user_jiffies"), Data: 25.0, Unit: "jiffies", Timestamp: ts},
+		}
+
+		Convey("metrics should be written as JSON", func() {
+			var buf bytes.Buffer
+			So(WriteMetrics(&buf, metrics, FormatJSON), ShouldBeNil)
+			written := []map[string]interface{}{}
+			So(json.Unmarshal(buf.Bytes(), &written), ShouldBeNil)
+			So(len(written), ShouldEqual, 2)
+			So(written[0]["namespace"], ShouldEqual, "/intel/procfs/cpu/1/user_jiffies")
+			So(written[0]["data"], ShouldEqual, 12.5)
+			So(written[0]["unit"], ShouldEqual, "jiffies")
+			So(written[1], ShouldNotContainKey, "tags")
+		})
+
+		Convey("metrics should be written as CSV", func() {
+			var buf bytes.Buffer
+			So(WriteMetrics(&buf, metrics, FormatCSV), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "namespace,data,unit,tags,timestamp\n"+
+				"/intel/procfs/cpu/1/user_jiffies,12.5,jiffies,\"core_id=1,socket_id=0\",2017-01-02T03:04:05Z\n"+
+				"/intel/procfs/cpu/all/user_jiffies,25,jiffies,,2017-01-02T03:04:05Z\n")
+		})
+
+		Convey("metrics should be written as aligned table", func() {
+			var buf bytes.Buffer
+			So(WriteMetrics(&buf, metrics, FormatTable), ShouldBeNil)
+			lines := strings.Split(buf.String(), "\n")
+			So(lines[0], ShouldStartWith, "NAMESPACE")
+			So(strings.Index(lines[1], "12.5"), ShouldEqual, strings.Index(lines[0], "DATA"))
+			So(lines[1], ShouldEndWith, "core_id=1,socket_id=0")
+		})
+
+		Convey("unknown format should return error", func() {
+			var buf bytes.Buffer
+			So(WriteMetrics(&buf, metrics, "xml"), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,94 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"unsafe"
+)
+
+const (
+	//auxvFile path in procfs of auxiliary vector passed by kernel to the plugin process
+	auxvFile = "self/auxv"
+
+	//atClkTck type of auxiliary vector entry with frequency of times() (USER_HZ, sysconf(_SC_CLK_TCK))
+	atClkTck = 17
+
+	//defaultClkTck frequency of clock ticks used when it cannot be detected (USER_HZ on most architectures)
+	defaultClkTck = 100
+)
+
+// getClkTck reads frequency of clock ticks in which CPU times are reported by procfs from auxiliary vector,
+// which consists of pairs of native words (type and value) terminated by entry of type 0
+func getClkTck(path string) (uint64, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	wordSize := strconv.IntSize / 8
+	byteOrder := nativeByteOrder()
+	for i := 0; i+2*wordSize <= len(content); i += 2 * wordSize {
+		key := readWord(content[i:], wordSize, byteOrder)
+		if key == 0 {
+			break
+		}
+		if key == atClkTck {
+			val := readWord(content[i+wordSize:], wordSize, byteOrder)
+			if val == 0 {
+				break
+			}
+			return val, nil
+		}
+	}
+	return 0, fmt.Errorf("Wrong %s format", path)
+}
+
+// readWord reads word of given size (4 or 8 bytes) from the beginning of b
+func readWord(b []byte, wordSize int, byteOrder binary.ByteOrder) uint64 {
+	if wordSize == 4 {
+		return uint64(byteOrder.Uint32(b))
+	}
+	return byteOrder.Uint64(b)
+}
+
+// nativeByteOrder returns byte order of architecture the plugin runs on
+func nativeByteOrder() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// setSeconds converts jiffies of given metrics held in stats to seconds using frequency of clock ticks
+func setSeconds(stats map[string]interface{}, metricNames []string, clkTck float64) {
+	for _, metricName := range metricNames {
+		val, ok := stats[getNamespaceMetricPart(metricName, jiffiesRepresentationType)].(float64)
+		if !ok {
+			continue
+		}
+		stats[getNamespaceMetricPart(metricName, secondsRepresentationType)] = val / clkTck
+	}
+}
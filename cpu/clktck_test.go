@@ -0,0 +1,116 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockAuxv builds auxiliary vector with given pairs of entry type and value, terminated by entry of type 0
+func mockAuxv(entries ...uint64) string {
+	wordSize := strconv.IntSize / 8
+	entries = append(entries, 0, 0)
+	content := make([]byte, len(entries)*wordSize)
+	for i, val := range entries {
+		if wordSize == 4 {
+			nativeByteOrder().PutUint32(content[i*wordSize:], uint32(val))
+		} else {
+			nativeByteOrder().PutUint64(content[i*wordSize:], val)
+		}
+	}
+	return string(content)
+}
+
+func (cis *CPUInfoSuite) TestGetClkTck() {
+	Convey("Given auxiliary vector with AT_CLKTCK entry", cis.T(), func() {
+		// AT_PAGESZ, AT_CLKTCK, AT_UID
+		loadMockProcFile(auxvFile, mockAuxv(6, 4096, atClkTck, 250, 11, 1000))
+		clkTck, err := getClkTck(mockProcRoot + "/" + auxvFile)
+		So(err, ShouldBeNil)
+		So(clkTck, ShouldEqual, 250)
+
+		Convey("auxiliary vector without AT_CLKTCK entry should return error", func() {
+			loadMockProcFile(auxvFile, mockAuxv(6, 4096))
+			_, err := getClkTck(mockProcRoot + "/" + auxvFile)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestSeconds() {
+	Convey("Given cpu plugin initialized with mocked /proc/stat", cis.T(), func() {
+		loadMockCPUInfo(0)
+
+		Convey("jiffies should be converted to seconds with frequency of clock ticks from auxiliary vector", func() {
+			loadMockProcFile(auxvFile, mockAuxv(atClkTck, 250))
+			p := mockNew()
+			So(p.clkTck, ShouldEqual, 250)
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{getNamespaceMetricPart(userProcStat, secondsRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 3464284.0/250)
+		})
+
+		Convey("frequency of clock ticks should be taken from configuration if it is set", func() {
+			loadMockProcFile(auxvFile, mockAuxv(atClkTck, 250))
+			p := New()
+			p.proc_path = mockPath
+			p.proc_root = mockProcRoot
+			So(p.init(plugin.Config{"clk_tck": int64(1000)}), ShouldBeNil)
+			So(p.clkTck, ShouldEqual, 1000)
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.stats[allCPU], []string{getNamespaceMetricPart(idleProcStat, secondsRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 402135.131)
+		})
+
+		Convey("default frequency of clock ticks should be used if it cannot be detected", func() {
+			p := mockNew()
+			So(p.clkTck, ShouldEqual, defaultClkTck)
+		})
+
+		Convey("collected metrics should have unit set", func() {
+			p := mockNew()
+			metrics, err := p.CollectMetrics([]plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, allCPU, getNamespaceMetricPart(userProcStat, secondsRepresentationType))},
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, allCPU, getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))},
+			})
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			So(metrics[0].Unit, ShouldEqual, "s")
+			So(metrics[1].Unit, ShouldEqual, "jiffies")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -89,16 +90,78 @@ const (
 	//percentageRepresentationType percentage representation type
 	percentageRepresentationType = "percentage"
 
-	//maxNamespaceSize max size of namespace for metrics
-	maxNamespaceSize = 5
+	//rateRepresentationType per-second rate representation type
+	rateRepresentationType = "rate"
+
+	//secondsRepresentationType seconds representation type (jiffies divided by frequency of clock ticks)
+	secondsRepresentationType = "seconds"
+
+	//percentageDenominatorSum percentages of CPU times are calculated over sum of all CPU times from /proc/stat
+	percentageDenominatorSum = "sum"
+
+	//percentageDenominatorSumWithoutGuest percentages of CPU times are calculated over sum of CPU times without
+	//guest and guest_nice, which are already included in user and nice
+	percentageDenominatorSumWithoutGuest = "sum_without_guest"
+
+	//percentageDenominatorElapsed percentages of CPU times are calculated over real time elapsed between reads
+	//multiplied by frequency of clock ticks (and number of CPUs for 'all')
+	percentageDenominatorElapsed = "elapsed"
+
+	//minNamespaceSize min size of namespace for metrics (prefix, CPU identifier and metric name)
+	minNamespaceSize = 5
 
 	//allCPU string indentifier for aggregation metrics (for all CPUs)
 	allCPU = "all"
 
 	//cpuStr string indentifier for /proc/stat line which have desired CPU metrics
 	cpuStr = "cpu"
+
+	//systemStats namespace part for system-wide metrics (not related to any CPU)
+	systemStats = "system"
+
+	//ctxtProcStat "ctxt" metric from /proc/stat, number of context switches
+	ctxtProcStat = "ctxt"
+
+	//intrProcStat "intr" metric from /proc/stat, total number of serviced interrupts
+	intrProcStat = "intr"
+
+	//processesProcStat "processes" metric from /proc/stat, number of forks since boot
+	processesProcStat = "processes"
+
+	//procsRunningProcStat "procs_running" metric from /proc/stat, number of runnable tasks
+	procsRunningProcStat = "procs_running"
+
+	//procsBlockedProcStat "procs_blocked" metric from /proc/stat, number of tasks blocked on I/O
+	procsBlockedProcStat = "procs_blocked"
+
+	//btimeProcStat "btime" metric from /proc/stat, boot time in seconds since the Epoch
+	btimeProcStat = "btime"
+
+	//softirqTotalProcStat "softirq" line from /proc/stat, total number of serviced softirqs
+	softirqTotalProcStat = "softirq"
+
+	//btimeTolerance seconds by which boot time may move without reboot, as it is derived from wall clock (e.g. stepped by NTP)
+	btimeTolerance = 5
+
+	//counterResetMetric "counter_reset" snap metric, 1 if counters have been reset since previous collection
+	//(reboot, restore of checkpointed container), 0 otherwise
+	counterResetMetric = "counter_reset"
 )
 
+// cpuProcStatMetricsNames names of CPU times in order of columns of CPU lines in /proc/stat
+var cpuProcStatMetricsNames = []string{userProcStat, niceProcStat, systemProcStat, idleProcStat,
+	iowaitProcStat, irqProcStat, softirqProcStat, stealProcStat, guestProcStat, guestNiceProcStat}
+
+// snapSpecificMetricsNames names of CPU times calculated by plugin
+var snapSpecificMetricsNames = []string{activeProcStat, utilizationProcStat}
+
+// sysProcStatMetricsNames names of system-wide metrics read from /proc/stat
+var sysProcStatMetricsNames = []string{ctxtProcStat, intrProcStat, processesProcStat,
+	procsRunningProcStat, procsBlockedProcStat, btimeProcStat, softirqTotalProcStat}
+
+// sysProcStatCounters names of monotonic system-wide counters for which per-second rates are calculated
+var sysProcStatCounters = []string{ctxtProcStat, intrProcStat, processesProcStat, softirqTotalProcStat}
+
 // CPUCollector plugin struct which gathers plugin specific data
 
 /* stats - metrics per cpu read from file /proc/stat:
@@ -109,24 +172,74 @@ map ["all": map["user_jiffies": x
 	      "user_percentage" x
 	      ... ]
      "1": ... ]
+
+   sysStats - system-wide metrics read from file /proc/stat:
+map ["ctxt": x
+     "ctxt_rate": x
+     ... ]
 */
 type CPUCollector struct {
 	initialized          bool
 	proc_path            string
-	cpuMetricsNumber     int // number of cpu + "all" metric
+	proc_root            string
+	sys_path             string
+	cgroup_path          string
 	stats                map[string]map[string]interface{}
+	sysStats             map[string]interface{}
+	sysRates             *rateTracker
+	softirqsRates        *rateTracker
+	interruptsRates      *rateTracker
+	interruptsTags       map[string]map[string]string
+	cpuidleRates         *rateTracker
+	schedstatRates       *rateTracker
+	raplRates            *rateTracker
+	raplCounters         map[string]raplCounter
+	topology             map[string]cpuTopology
+	topologyCPUs         string
+	topologyTags         bool
+	topologyStats        map[string]map[string]interface{}
+	prevTopology         map[string]topologySample
+	cgroupStats          map[string]interface{}
+	cgroupTags           map[string]map[string]string
+	cgroupRates          *rateTracker
+	processTopN          int64
+	processFilter        processFilter
+	processStats         map[string]interface{}
+	processTags          map[string]map[string]string
+	prevProcesses        map[string]processSample
+	prevProcessTotal     float64
+	prevProcessGuest     float64
+	prevProcessTime      time.Time
+	processDiffTotal     float64
+	threadStats          map[string]interface{}
+	threadTags           map[string]map[string]string
+	prevThreads          map[string]processSample
 	prevMetricsSum       map[string]float64
+	procStatTime         time.Time
+	clkTck               float64
+	percentDenominator   string
 	procStatMetricsNames []string
 	snapMetricsNames     []string
 }
 
-// defaultProcPath source of data for metrics
-var defaultProcPath = "/proc"
+// DefaultProcPath source of data for metrics
+var DefaultProcPath = "/proc"
+
+// DefaultPercentageDenominator guest time is not counted twice in percentages by default
+var DefaultPercentageDenominator = percentageDenominatorSumWithoutGuest
+
+// DefaultTopologyTags per-CPU metrics are tagged with CPU topology by default
+var DefaultTopologyTags = true
 
 // New creates instance of interface info plugin
 func New() *CPUCollector {
 	return &CPUCollector{
-		proc_path: defaultProcPath + "/stat",
+		proc_path:    DefaultProcPath + "/stat",
+		proc_root:    DefaultProcPath,
+		sys_path:     DefaultSysPath,
+		cgroup_path:  DefaultCgroupPath,
+		topologyTags: DefaultTopologyTags,
+		processTopN:  DefaultProcessTopN,
 	}
 }
 
@@ -134,7 +247,15 @@ func New() *CPUCollector {
 // It returns error in case retrieval was not successful
 func (p *CPUCollector) GetConfigPolicy() (plugin.ConfigPolicy, error) {
 	policy := plugin.NewConfigPolicy()
-	policy.AddNewStringRule([]string{vendor, fs, Name}, "proc_path", false, plugin.SetDefaultString(defaultProcPath))
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "proc_path", false, plugin.SetDefaultString(DefaultProcPath))
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "sys_path", false, plugin.SetDefaultString(DefaultSysPath))
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "cgroup_path", false, plugin.SetDefaultString(DefaultCgroupPath))
+	policy.AddNewBoolRule([]string{vendor, fs, Name}, "topology_tags", false, plugin.SetDefaultBool(DefaultTopologyTags))
+	policy.AddNewIntRule([]string{vendor, fs, Name}, "process_top_n", false, plugin.SetDefaultInt(DefaultProcessTopN), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{vendor, fs, Name}, "clk_tck", false)
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "percentage_denominator", false, plugin.SetDefaultString(DefaultPercentageDenominator))
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "process_include", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{vendor, fs, Name}, "process_exclude", false, plugin.SetDefaultString(""))
 
 	return *policy, nil
 }
@@ -147,16 +268,42 @@ func (p *CPUCollector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error
 			return nil, err
 		}
 	}
-	if err := getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames); err != nil {
+	ts := time.Now()
+	if err := p.readProcStat(ts); err != nil {
 		return nil, err
 	}
+	// metrics of other sources are listed only if they can be read, so a source which is not accessible
+	// (e.g. debugfs or powercap readable only by root) or cannot be parsed does not prevent loading of plugin;
+	// errors of these sources are still reported when their metrics are collected
+	optionalReaders := []func() error{
+		func() error { return p.readSoftirqs(ts) },
+		func() error { return p.readInterrupts(ts) },
+		p.readCpufreq,
+		func() error { return p.readCpuidle(ts) },
+		p.readCpuinfo,
+		func() error { return p.readSchedstat(ts) },
+		p.readRunqueue,
+		p.readLoadavg,
+		p.readPressure,
+		p.readTopology,
+		p.readThermal,
+		func() error { return p.readRapl(ts) },
+	}
+	for _, read := range optionalReaders {
+		read()
+	}
 	mts := []plugin.Metric{}
 
 	namespaces := []string{}
+	groupNamespaces := make(map[string]plugin.Namespace)
 
 	prefix := filepath.Join(vendor, fs, Name)
 	for cpu, stats := range p.stats {
-		for metric, _ := range stats {
+		for metric, v := range stats {
+			if group, ok := v.(map[string]interface{}); ok {
+				getGroupNamespaces(plugin.NewNamespace(metric), group, groupNamespaces)
+				continue
+			}
 			namespaces = append(namespaces, prefix+"/"+cpu+"/"+metric)
 		}
 	}
@@ -182,6 +329,78 @@ func (p *CPUCollector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error
 		}
 	}
 
+	// threads which last ran on CPU are known only after processes are collected
+	threadsNs := plugin.NewNamespace(threadsGroup).
+		AddDynamicElement(groupDynamicElements[threadsGroup].name, groupDynamicElements[threadsGroup].description).
+		AddStaticElement(processCPUPercentage)
+	groupNamespaces[threadsNs.String()] = threadsNs
+	for _, groupNs := range groupNamespaces {
+		ns := plugin.NewNamespace(vendor, fs, Name).
+			AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)")
+		mts = append(mts, plugin.Metric{
+			Namespace:   append(ns, groupNs...),
+			Description: "dynamic CPU " + groupNs[0].Value + " metric: " + groupNs[len(groupNs)-1].Value,
+		})
+	}
+
+	for level, levelStats := range p.topologyStats {
+		levelMetrics := make(map[string]bool)
+		for _, groupStats := range levelStats {
+			for metric := range groupStats.(map[string]interface{}) {
+				levelMetrics[metric] = true
+			}
+		}
+		for metric := range levelMetrics {
+			mts = append(mts, plugin.Metric{
+				Namespace: plugin.NewNamespace(vendor, fs, Name, level).
+					AddDynamicElement(topologyLevels[level].name, topologyLevels[level].description).
+					AddStaticElement(metric),
+				Description: "dynamic " + level + " metric: " + metric,
+			})
+		}
+	}
+
+	for _, metric := range cgroupMetricsNames {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace(vendor, fs, Name, cgroupLevel).
+				AddDynamicElement("cgroup", "path of cgroup relative to root of cgroup hierarchy with '/' replaced by ':'").
+				AddStaticElement(metric),
+			Description: "dynamic cgroup metric: " + metric,
+		})
+	}
+	for _, metric := range processMetricsNames {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace(vendor, fs, Name, processLevel).
+				AddDynamicElement("pid", "ID of process").
+				AddStaticElement(metric),
+			Description: "dynamic process metric: " + metric,
+		})
+	}
+	for _, metric := range threadMetricsNames {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace(vendor, fs, Name, threadLevel).
+				AddDynamicElement("tid", "ID of thread").
+				AddStaticElement(metric),
+			Description: "dynamic thread metric: " + metric,
+		})
+	}
+
+	mts = append(mts, plugin.Metric{
+		Namespace: plugin.NewNamespace(vendor, fs, Name, cgroupLevel).
+			AddDynamicElement("cgroup", "path of cgroup relative to root of cgroup hierarchy with '/' replaced by ':'").
+			AddStaticElement(cgroupPercpu).
+			AddDynamicElement("cpuID", "ID of CPU").
+			AddStaticElement(cgroupUsage),
+		Description: "dynamic cgroup metric: per-CPU " + cgroupUsage,
+	})
+
+	for metric := range p.sysStats {
+		mts = append(mts, plugin.Metric{
+			Namespace:   plugin.NewNamespace(vendor, fs, Name, systemStats, metric),
+			Description: "system-wide metric: " + metric,
+		})
+	}
+
 	return mts, nil
 }
 
@@ -194,43 +413,117 @@ func (p *CPUCollector) CollectMetrics(mts []plugin.Metric) ([]plugin.Metric, err
 			return nil, err
 		}
 	}
-	if err := getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames); err != nil {
+	ts := time.Now()
+	if err := p.readProcStat(ts); err != nil {
 		return nil, err
 	}
-	ts := time.Now()
+	if isGroupRequested(mts, softirqsGroup) {
+		if err := p.readSoftirqs(ts); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, interruptsGroup) {
+		if err := p.readInterrupts(ts); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, cpufreqGroup) {
+		if err := p.readCpufreq(); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, cpuidleGroup) {
+		if err := p.readCpuidle(ts); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, infoGroup) {
+		if err := p.readCpuinfo(); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, schedstatGroup) || isLevelRequested(mts, systemStats) {
+		if err := p.readSchedstat(ts); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, runqueueGroup) {
+		if err := p.readRunqueue(); err != nil {
+			return nil, err
+		}
+	}
+	if isLevelRequested(mts, systemStats) {
+		if err := p.readLoadavg(); err != nil {
+			return nil, err
+		}
+		if err := p.readPressure(); err != nil {
+			return nil, err
+		}
+	}
+	if isLevelRequested(mts, cgroupLevel) {
+		if err := p.readCgroups(ts); err != nil {
+			return nil, err
+		}
+	}
+	if isLevelRequested(mts, processLevel) || isLevelRequested(mts, threadLevel) || isGroupRequested(mts, threadsGroup) {
+		if err := p.readProcesses(); err != nil {
+			return nil, err
+		}
+		if err := p.readThreads(); err != nil {
+			return nil, err
+		}
+	}
+	if isTopologyRequested(mts) {
+		if err := p.readTopology(); err != nil {
+			return nil, err
+		}
+	} else if p.topologyTags {
+		if err := p.refreshTopology(); err != nil {
+			return nil, err
+		}
+	}
+	if isGroupRequested(mts, thermalGroup) || isLevelRequested(mts, socketLevel) {
+		if err := p.readThermal(); err != nil {
+			return nil, err
+		}
+	}
+	if isLevelRequested(mts, socketLevel) {
+		if err := p.readRapl(ts); err != nil {
+			return nil, err
+		}
+	}
+	cpuTree := make(map[string]interface{}, len(p.stats))
+	for cpuID, cpuStats := range p.stats {
+		cpuTree[cpuID] = cpuStats
+	}
 	for _, mt := range mts {
 		ns := mt.Namespace
-		if len(ns) != maxNamespaceSize {
+		if len(ns) < minNamespaceSize {
 			return nil, fmt.Errorf("Incorrect namespace length (len = %d)", len(ns))
 		}
-		if ns[len(ns)-2].Value == "*" {
-			for cpuId, cpuStats := range p.stats {
-				for k, v := range cpuStats {
-					if ns[len(ns)-1].Value == k && v != nil {
-						ns1 := make([]plugin.NamespaceElement, len(ns))
-						copy(ns1, ns)
-						ns1[len(ns)-2].Value = cpuId
-						metric := plugin.Metric{
-							Namespace: ns1,
-							Data:      v,
-							Timestamp: ts,
-							Version:   Version,
-						}
-						metrics = append(metrics, metric)
-					}
-				}
-			}
+		var found []plugin.Metric
+		var err error
+		if ns[3].Value == systemStats {
+			found, err = getMetricsByNamespace(p.sysStats, ns, 4, false)
+		} else if ns[3].Value == cgroupLevel {
+			found, err = getMetricsByNamespace(p.cgroupStats, ns, 4, false)
+		} else if ns[3].Value == processLevel {
+			found, err = getMetricsByNamespace(p.processStats, ns, 4, false)
+		} else if ns[3].Value == threadLevel {
+			found, err = getMetricsByNamespace(p.threadStats, ns, 4, false)
+		} else if _, ok := topologyLevels[ns[3].Value]; ok {
+			found, err = getMetricsByNamespace(p.topologyStats[ns[3].Value], ns, 4, false)
 		} else {
-			val, err := getMapValueByNamespace(p.stats[ns.Strings()[3]], ns.Strings()[4:])
-			if err != nil {
-				return metrics, err
-			}
-			metric := plugin.Metric{
-				Namespace: ns,
-				Data:      val,
-				Timestamp: ts,
-				Version:   Version,
-			}
+			found, err = getMetricsByNamespace(cpuTree, ns, 3, false)
+		}
+		if err != nil {
+			return metrics, err
+		}
+		for _, metric := range found {
+			metric.Timestamp = ts
+			metric.Version = Version
+			metric.Tags = p.getTags(metric.Namespace)
+			metric.Unit = getUnit(metric.Namespace, metric.Data)
 			metrics = append(metrics, metric)
 		}
 	}
@@ -242,6 +535,48 @@ func (p *CPUCollector) init(cfg plugin.Config) error {
 	if err == nil {
 		// change default if proc_path supplied
 		p.proc_path = procPath + "/stat"
+		p.proc_root = procPath
+	}
+	sysPath, err := cfg.GetString("sys_path")
+	if err == nil {
+		// change default if sys_path supplied
+		p.sys_path = sysPath
+	}
+	cgroupPath, err := cfg.GetString("cgroup_path")
+	if err == nil {
+		// change default if cgroup_path supplied
+		p.cgroup_path = cgroupPath
+	}
+	topologyTags, err := cfg.GetBool("topology_tags")
+	if err == nil {
+		p.topologyTags = topologyTags
+	}
+	processTopN, err := cfg.GetInt("process_top_n")
+	if err == nil {
+		if processTopN < 0 {
+			return fmt.Errorf("Negative number of processes process_top_n %d", processTopN)
+		}
+		p.processTopN = processTopN
+	}
+	p.clkTck = defaultClkTck
+	if clkTck, err := cfg.GetInt("clk_tck"); err == nil && clkTck > 0 {
+		p.clkTck = float64(clkTck)
+	} else if clkTck, err := getClkTck(filepath.Join(p.proc_root, auxvFile)); err == nil {
+		p.clkTck = float64(clkTck)
+	}
+	p.percentDenominator = DefaultPercentageDenominator
+	if denominator, err := cfg.GetString("percentage_denominator"); err == nil {
+		switch denominator {
+		case percentageDenominatorSum, percentageDenominatorSumWithoutGuest, percentageDenominatorElapsed:
+			p.percentDenominator = denominator
+		default:
+			return fmt.Errorf("Unknown percentage denominator %s", denominator)
+		}
+	}
+	processInclude, _ := cfg.GetString("process_include")
+	processExclude, _ := cfg.GetString("process_exclude")
+	if p.processFilter, err = newProcessFilter(processInclude, processExclude); err != nil {
+		return err
 	}
 
 	fh, err := os.Open(p.proc_path)
@@ -250,140 +585,644 @@ func (p *CPUCollector) init(cfg plugin.Config) error {
 	}
 	defer fh.Close()
 
-	var procStatMetricsNumber int
-	p.cpuMetricsNumber, procStatMetricsNumber, err = getInitialProcStatData(p.proc_path)
+	procStatMetricsNumber, err := getInitialProcStatData(p.proc_path)
 	if err != nil {
 		return err
 	}
 
 	// initialize metric names arrays
-	p.procStatMetricsNames = []string{userProcStat, niceProcStat, systemProcStat, idleProcStat,
-		iowaitProcStat, irqProcStat, softirqProcStat, stealProcStat, guestProcStat, guestNiceProcStat}[0:procStatMetricsNumber]
-	snapSpecificMetricsNames := []string{activeProcStat, utilizationProcStat}
+	p.procStatMetricsNames = cpuProcStatMetricsNames[0:procStatMetricsNumber]
 
 	// build snapMetricsNames to support different kernels
 	// var snapMetricsNames []string
 	p.snapMetricsNames = append(p.snapMetricsNames, p.procStatMetricsNames...)
 	p.snapMetricsNames = append(p.snapMetricsNames, snapSpecificMetricsNames...)
 	p.stats = make(map[string]map[string]interface{})
+	p.sysStats = make(map[string]interface{})
+	p.sysRates = newRateTracker()
+	p.softirqsRates = newRateTracker()
+	p.interruptsRates = newRateTracker()
+	p.cpuidleRates = newRateTracker()
+	p.schedstatRates = newRateTracker()
+	p.raplRates = newRateTracker()
+	p.raplCounters = make(map[string]raplCounter)
+	p.cgroupRates = newRateTracker()
 	p.prevMetricsSum = make(map[string]float64)
 	p.initialized = true
 	return nil
 }
 
-// getStats gets metrics from /proc/stat output and calculates snap specific metrics
-func getStats(path string, stats map[string]map[string]interface{}, prevMetricsSum map[string]float64, cpuMetricsNumber int, snapMetricsNames []string, procStatMetricsNames []string) (err error) {
+// readProcStat reads /proc/stat, calculates rates of system-wide counters for sample taken at ts
+// and sets online state of present CPUs; rates of CPU times are calculated over real time elapsed
+// since previous read, measured by monotonic clock reading of ts (as obtained from time.Now)
+func (p *CPUCollector) readProcStat(ts time.Time) error {
+	opts := cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator}
+	if !p.procStatTime.IsZero() {
+		opts.elapsed = ts.Sub(p.procStatTime).Seconds()
+	}
+	if err := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, opts); err != nil {
+		return err
+	}
+	p.procStatTime = ts
+	if p.sysStats[counterResetMetric] == uint64(1) {
+		p.resetRates()
+	} else {
+		for cpuID, cpuStats := range p.stats {
+			if cpuStats[counterResetMetric] == uint64(1) {
+				p.resetCPURates(cpuID)
+			}
+		}
+	}
+	for _, cpuStats := range p.stats {
+		setSeconds(cpuStats, p.snapMetricsNames, p.clkTck)
+	}
+	getSysRates(p.sysStats, p.sysRates, ts)
+	return p.readOnline()
+}
+
+// byNumericID sorts numeric identifiers (e.g. of CPUs) in ascending order
+type byNumericID []string
+
+func (s byNumericID) Len() int      { return len(s) }
+func (s byNumericID) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byNumericID) Less(i, j int) bool {
+	a, _ := strconv.ParseUint(s[i], 10, 64)
+	b, _ := strconv.ParseUint(s[j], 10, 64)
+	return a < b
+}
+
+// getOnlineCPUs returns sorted identifiers of CPUs reported in /proc/stat
+func (p *CPUCollector) getOnlineCPUs() []string {
+	cpuIDs := []string{}
+	for cpuID, cpuStats := range p.stats {
+		if _, online := cpuStats[getNamespaceMetricPart(userProcStat, jiffiesRepresentationType)]; online && cpuID != allCPU {
+			cpuIDs = append(cpuIDs, cpuID)
+		}
+	}
+	sort.Strings(cpuIDs)
+	return cpuIDs
+}
+
+// resetCPURates forgets previous samples of per-CPU counters of CPU with given identifier,
+// so rates are not calculated across reset of counters of this CPU
+func (p *CPUCollector) resetCPURates(cpuID string) {
+	for _, rates := range []*rateTracker{p.softirqsRates, p.interruptsRates, p.cpuidleRates, p.schedstatRates} {
+		rates.resetPrefix(cpuID + "/")
+	}
+}
+
+// resetRates forgets previous samples of all counters, so rates are not calculated across counter reset;
+// RAPL energy counters going down after reset are not taken for wraparound
+func (p *CPUCollector) resetRates() {
+	for _, rates := range []*rateTracker{p.sysRates, p.softirqsRates, p.interruptsRates, p.cpuidleRates, p.schedstatRates, p.raplRates, p.cgroupRates} {
+		rates.reset()
+	}
+	p.raplCounters = make(map[string]raplCounter)
+}
+
+// getStats gets metrics from /proc/stat output and calculates snap specific metrics,
+// CPU lines are identified by CPU ID on every read, so CPUs may go offline and come back (hotplug);
+// state of CPUs not reported anymore is dropped, other lines are parsed as system-wide metrics.
+// Reboot (or restore of checkpointed container) is detected by boot time moving by more than btimeTolerance
+// or by counters of all CPUs known from previous read going down, counters of all CPUs are re-baselined then;
+// otherwise only counters of CPU which counters went down (e.g. idle time on tickless kernels) are re-baselined;
+// such a discontinuity is reported by counter_reset metric. Rates (CPU-seconds per second) and percentages
+// of CPU times are calculated according to opts
+func getStats(path string, stats map[string]map[string]interface{}, sysStats map[string]interface{}, prevMetricsSum map[string]float64, snapMetricsNames []string, procStatMetricsNames []string, opts cpuTimesOptions) (err error) {
 	fh, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
+	prevBtime, btimeKnown := sysStats[btimeProcStat].(uint64)
+
+	// CPU lines are processed when the whole file is read, as number of CPUs and boot time are needed
+	cpuLines := [][]string{}
 	scanner := bufio.NewScanner(fh)
-	for i := 0; i < cpuMetricsNumber; i++ {
-		scanErr := scanner.Scan()
-		if !scanErr {
-			return fmt.Errorf("Wrong %s format", path)
-		}
+	for scanner.Scan() {
 		fields := strings.Fields(scanner.Text())
-
 		if len(fields) < 2 {
-			return fmt.Errorf("Wrong %s format", path)
+			continue
 		}
-
-		cpuID := strings.TrimSpace(fields[0])
-		if cpuID == cpuStr {
-			if err != nil {
-				return err
-			}
-			cpuID = allCPU //change CPU identifier for aggregation metrics
-		} else {
-			cpuID = strings.TrimPrefix(cpuID, cpuStr) //get number from CPU indentifier, for example if CPU identifier is cpu42 then 42 is get
+		if strings.HasPrefix(fields[0], cpuStr) {
+			cpuLines = append(cpuLines, fields)
+			continue
+		}
+		if err := getSysStat(fields, sysStats); err != nil {
+			return err
 		}
-		metrics := fields[1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(cpuLines) == 0 {
+		return fmt.Errorf("Wrong %s format", path)
+	}
 
-		if len(metrics) != len(procStatMetricsNames) {
-			return fmt.Errorf("Wrong data length. Expected {%d} is {%d}",
-				len(procStatMetricsNames), len(metrics))
+	rebooted, err := isAllCountersDown(cpuLines, prevMetricsSum)
+	if err != nil {
+		return err
+	}
+	if btime, ok := sysStats[btimeProcStat].(uint64); ok && btimeKnown {
+		rebooted = rebooted || btime > prevBtime+btimeTolerance || prevBtime > btime+btimeTolerance
+	}
+	if rebooted {
+		for cpuID := range prevMetricsSum {
+			delete(prevMetricsSum, cpuID)
 		}
+	}
 
-		//sum of new data in line
-		currDataSum, err := strTabSum(metrics)
+	cpuIDs := make(map[string]bool)
+	for _, fields := range cpuLines {
+		cpuID, err := getCPUStats(fields, stats, prevMetricsSum, snapMetricsNames, procStatMetricsNames, opts, len(cpuLines)-1)
 		if err != nil {
 			return err
 		}
+		if rebooted {
+			stats[cpuID][counterResetMetric] = uint64(1)
+		}
+		cpuIDs[cpuID] = true
+	}
+	sysStats[counterResetMetric] = boolToUint(rebooted)
+
+	// drop state of CPUs which went offline
+	for cpuID := range stats {
+		if !cpuIDs[cpuID] {
+			delete(stats, cpuID)
+			delete(prevMetricsSum, cpuID)
+		}
+	}
+	return nil
+}
 
-		metricStats := make(map[string]interface{})
-		for j := range snapMetricsNames {
+// isAllCountersDown checks if sums of counters of all CPU lines known from previous read went down,
+// false is returned when none of CPU lines is known
+func isAllCountersDown(cpuLines [][]string, prevMetricsSum map[string]float64) (bool, error) {
+	known := false
+	for _, fields := range cpuLines {
+		cpuID := getCPUID(fields[0])
+		if !mapKeyExists(cpuID, prevMetricsSum) {
+			continue
+		}
+		currDataSum, err := strTabSum(fields[1:])
+		if err != nil {
+			return false, err
+		}
+		if currDataSum >= prevMetricsSum[cpuID] {
+			return false, nil
+		}
+		known = true
+	}
+	return known, nil
+}
 
-			metricName := snapMetricsNames[j]
-			var currVal float64
-			//data collecting, there is an assumption that firstly metrics from /proc/stat/
-			//are gathered then snap specific metrics (e.g. active and utilization are calculated)
-			if metricName == activeProcStat {
-				idleVal, err := getMapFloatValueByNamespace(metricStats,
-					[]string{getNamespaceMetricPart(idleProcStat, jiffiesRepresentationType)})
-				if err != nil {
-					return err
-				}
-				currVal = currDataSum - idleVal
-			} else if metricName == utilizationProcStat {
-				nonActiveVal, err := getMapFloatValueByNamespace(metricStats,
-					[]string{getNamespaceMetricPart(idleProcStat, jiffiesRepresentationType)})
-				if err != nil {
-					return err
-				}
+// getCPUID returns CPU identifier of CPU line of /proc/stat with given first field (e.g. cpu42 gives 42, cpu gives 'all')
+func getCPUID(field string) string {
+	cpuID := strings.TrimSpace(field)
+	if cpuID == cpuStr {
+		return allCPU //change CPU identifier for aggregation metrics
+	}
+	return strings.TrimPrefix(cpuID, cpuStr) //get number from CPU indentifier, for example if CPU identifier is cpu42 then 42 is get
+}
 
-				currVal = currDataSum - nonActiveVal
+// getCPUStats parses CPU line of /proc/stat (e.g. cpu0 3464284 998669 ...), calculates snap specific metrics
+// and stores them in stats under CPU identifier which is returned; if sum of CPU counters went down,
+// counters are re-baselined and reset is reported by counter_reset metric; cpus is number of CPUs aggregated in 'all' line
+func getCPUStats(fields []string, stats map[string]map[string]interface{}, prevMetricsSum map[string]float64, snapMetricsNames []string, procStatMetricsNames []string, opts cpuTimesOptions, cpus int) (cpuID string, err error) {
+	cpuID = getCPUID(fields[0])
+	metrics := fields[1:]
 
-				nonActiveVal, err = getMapFloatValueByNamespace(metricStats,
-					[]string{getNamespaceMetricPart(iowaitProcStat, jiffiesRepresentationType)})
-				if err != nil {
-					return err
-				}
+	if len(metrics) != len(procStatMetricsNames) {
+		return cpuID, fmt.Errorf("Wrong data length. Expected {%d} is {%d}",
+			len(procStatMetricsNames), len(metrics))
+	}
 
-				currVal = currVal - nonActiveVal
-			} else {
-				currVal, err = strconv.ParseFloat(metrics[j], 64)
+	//sum of new data in line
+	currDataSum, err := strTabSum(metrics)
+	if err != nil {
+		return cpuID, err
+	}
+
+	// counters going down mean that they have been reset, so current values become the new baseline
+	reset := mapKeyExists(cpuID, prevMetricsSum) && currDataSum < prevMetricsSum[cpuID]
+	if reset {
+		delete(prevMetricsSum, cpuID)
+	}
+
+	// jiffies over which percentages are calculated, guest time is accounted also in user (and guest_nice in nice) time
+	var denominator, diffGuest float64
+	if mapKeyExists(cpuID, prevMetricsSum) {
+		currGuest := 0.0
+		for j, metricName := range procStatMetricsNames {
+			if metricName == guestProcStat || metricName == guestNiceProcStat {
+				guestVal, err := strconv.ParseFloat(metrics[j], 64)
 				if err != nil {
-					return err
+					return cpuID, err
 				}
+				currGuest += guestVal
+			}
+		}
+		diffGuest = currGuest - getGuestJiffies(stats[cpuID])
+		lineCPUs := 1
+		if cpuID == allCPU {
+			lineCPUs = cpus
+		}
+		denominator = getPercentageDenominator(opts, currDataSum-prevMetricsSum[cpuID], diffGuest, lineCPUs)
+	}
+
+	metricStats := make(map[string]interface{})
+	metricStats[counterResetMetric] = boolToUint(reset)
+	for j := range snapMetricsNames {
+
+		metricName := snapMetricsNames[j]
+		var currVal float64
+		//data collecting, there is an assumption that firstly metrics from /proc/stat/
+		//are gathered then snap specific metrics (e.g. active and utilization are calculated)
+		if metricName == activeProcStat {
+			idleVal, err := getMapFloatValueByNamespace(metricStats,
+				[]string{getNamespaceMetricPart(idleProcStat, jiffiesRepresentationType)})
+			if err != nil {
+				return cpuID, err
+			}
+			currVal = currDataSum - idleVal
+		} else if metricName == utilizationProcStat {
+			nonActiveVal, err := getMapFloatValueByNamespace(metricStats,
+				[]string{getNamespaceMetricPart(idleProcStat, jiffiesRepresentationType)})
+			if err != nil {
+				return cpuID, err
+			}
+
+			currVal = currDataSum - nonActiveVal
+
+			nonActiveVal, err = getMapFloatValueByNamespace(metricStats,
+				[]string{getNamespaceMetricPart(iowaitProcStat, jiffiesRepresentationType)})
+			if err != nil {
+				return cpuID, err
+			}
+
+			currVal = currVal - nonActiveVal
+		} else {
+			currVal, err = strconv.ParseFloat(metrics[j], 64)
+			if err != nil {
+				return cpuID, err
+			}
+		}
+
+		metricStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = nil
+		metricStats[getNamespaceMetricPart(metricName, rateRepresentationType)] = nil
+
+		if mapKeyExists(cpuID, prevMetricsSum) {
+			prevVal, err := getMapFloatValueByNamespace(stats[cpuID],
+				[]string{getNamespaceMetricPart(metricName, jiffiesRepresentationType)})
+			if err != nil {
+				return cpuID, err
 			}
 
-			metricStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = nil
-
-			if mapKeyExists(cpuID, prevMetricsSum) {
-				diffSum := currDataSum - prevMetricsSum[cpuID]
-				if diffSum > 0 {
-					prevVal, err := getMapFloatValueByNamespace(stats[cpuID],
-						[]string{getNamespaceMetricPart(metricName, jiffiesRepresentationType)})
-					if err != nil {
-						return err
-					}
-
-					if percVal := float64(100 * (currVal - prevVal) / diffSum); percVal < 0 {
-						fmt.Fprintf(os.Stderr, "Percentage value of %v could not be calculated due to invalid data reported by /proc/stat\n", getNamespaceMetricPart(metricName, percentageRepresentationType))
-					} else {
-						metricStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = percVal
-					}
-				} else {
-					fmt.Fprintf(os.Stderr, "Percentage value of %v could not be calculated due to invalid data reported by /proc/stat\n", getNamespaceMetricPart(metricName, percentageRepresentationType))
+			// single counter going down (e.g. iowait on tickless kernels) leaves percentage and rate not available
+			diffVal := currVal - prevVal
+			if opts.denominator != percentageDenominatorSum && isGuestCountedTwice(metricName) {
+				diffVal -= diffGuest
+			}
+			if denominator > 0 {
+				if percVal := float64(100 * diffVal / denominator); percVal >= 0 {
+					metricStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = percVal
 				}
 			}
-			metricStats[getNamespaceMetricPart(metricName, jiffiesRepresentationType)] = currVal
+			if opts.elapsed > 0 && currVal >= prevVal {
+				metricStats[getNamespaceMetricPart(metricName, rateRepresentationType)] = (currVal - prevVal) / opts.clkTck / opts.elapsed
+			}
+		}
+		metricStats[getNamespaceMetricPart(metricName, jiffiesRepresentationType)] = currVal
+	}
+	stats[cpuID] = metricStats
+	prevMetricsSum[cpuID] = currDataSum
+	return cpuID, nil
+}
+
+// cpuTimesOptions options of calculation of rates and percentages of CPU times read from /proc/stat
+type cpuTimesOptions struct {
+	//clkTck frequency of clock ticks in which CPU times are reported
+	clkTck float64
+
+	//elapsed seconds of real time elapsed since previous read, 0 for the first read
+	elapsed float64
+
+	//denominator way of calculation of percentage denominator (sum, sum_without_guest or elapsed)
+	denominator string
+}
+
+// getPercentageDenominator returns jiffies over which percentages of CPU times are calculated according to opts,
+// diffSum is increase of sum of all CPU times of given number of CPUs since previous read and diffGuest increase
+// of their guest and guest_nice times
+func getPercentageDenominator(opts cpuTimesOptions, diffSum float64, diffGuest float64, cpus int) float64 {
+	switch opts.denominator {
+	case percentageDenominatorSumWithoutGuest:
+		return diffSum - diffGuest
+	case percentageDenominatorElapsed:
+		return opts.elapsed * opts.clkTck * float64(cpus)
+	}
+	return diffSum
+}
+
+// getGuestJiffies returns sum of guest and guest_nice jiffies held in stats (0 if not reported)
+func getGuestJiffies(stats map[string]interface{}) float64 {
+	sum := 0.0
+	for _, metricName := range []string{guestProcStat, guestNiceProcStat} {
+		if val, ok := stats[getNamespaceMetricPart(metricName, jiffiesRepresentationType)].(float64); ok {
+			sum += val
 		}
-		stats[cpuID] = metricStats
-		prevMetricsSum[cpuID] = currDataSum
+	}
+	return sum
+}
+
+// isGuestCountedTwice checks if CPU time calculated by plugin with given name counts guest time twice,
+// as it is calculated from sum of all CPU times from /proc/stat; guest time is not taken into account
+// in its percentage unless the sum is the percentage denominator
+func isGuestCountedTwice(metricName string) bool {
+	return metricName == activeProcStat || metricName == utilizationProcStat
+}
+
+// getSysStat parses system-wide /proc/stat line (e.g. ctxt 123456), lines other than listed
+// in sysProcStatMetricsNames are omitted; for "intr" line only total number of interrupts is taken
+func getSysStat(fields []string, sysStats map[string]interface{}) error {
+	for _, metricName := range sysProcStatMetricsNames {
+		if fields[0] != metricName {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		sysStats[metricName] = val
 	}
 	return nil
 }
 
+// getSysRates calculates per-second rates of monotonic system-wide counters,
+// rate is nil for the first sample or when counter has been reset
+func getSysRates(sysStats map[string]interface{}, rates *rateTracker, ts time.Time) {
+	rates.sample(ts)
+	for _, metricName := range sysProcStatCounters {
+		val, ok := sysStats[metricName].(uint64)
+		if !ok {
+			continue
+		}
+		sysStats[getNamespaceMetricPart(metricName, rateRepresentationType)] = rates.rate(metricName, float64(val))
+	}
+}
+
+// rateTracker keeps previous samples of monotonic counters to calculate per-second rates
+type rateTracker struct {
+	prev     map[string]float64
+	seen     map[string]bool
+	prevTime time.Time
+	currTime time.Time
+}
+
+// newRateTracker creates empty rateTracker
+func newRateTracker() *rateTracker {
+	return &rateTracker{
+		prev: make(map[string]float64),
+		seen: make(map[string]bool),
+	}
+}
+
+// sample starts new sample taken at ts, counters not updated in previous sample are forgotten
+func (r *rateTracker) sample(ts time.Time) {
+	for key := range r.prev {
+		if !r.seen[key] {
+			delete(r.prev, key)
+		}
+	}
+	r.seen = make(map[string]bool)
+	r.prevTime = r.currTime
+	r.currTime = ts
+}
+
+// reset forgets all previous samples
+func (r *rateTracker) reset() {
+	r.prev = make(map[string]float64)
+	r.seen = make(map[string]bool)
+	r.currTime = time.Time{}
+}
+
+// resetPrefix forgets previous samples of counters which key starts with prefix
+func (r *rateTracker) resetPrefix(prefix string) {
+	for key := range r.prev {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.prev, key)
+		}
+	}
+}
+
+// rate stores value of counter identified by key and returns its per-second rate since previous sample,
+// nil is returned when rate cannot be calculated (first sample, counter going down)
+func (r *rateTracker) rate(key string, val float64) interface{} {
+	prev, ok := r.prev[key]
+	r.prev[key] = val
+	r.seen[key] = true
+	if !ok || r.prevTime.IsZero() {
+		return nil
+	}
+	elapsed := r.elapsed()
+	if elapsed <= 0 || val < prev {
+		return nil
+	}
+	return (val - prev) / elapsed
+}
+
+// elapsed returns seconds elapsed between previous and current sample, 0 if there is no previous sample
+func (r *rateTracker) elapsed() float64 {
+	if r.prevTime.IsZero() {
+		return 0
+	}
+	return r.currTime.Sub(r.prevTime).Seconds()
+}
+
+// delta stores value of counter identified by key and returns its increase since previous sample,
+// false is returned when increase cannot be calculated (first sample, counter going down)
+func (r *rateTracker) delta(key string, val float64) (float64, bool) {
+	prev, ok := r.prev[key]
+	r.prev[key] = val
+	r.seen[key] = true
+	if !ok || val < prev {
+		return 0, false
+	}
+	return val - prev, true
+}
+
+// getTags returns tags of collected metric with given namespace, nil is returned for metrics without tags;
+// per-CPU metrics are tagged with topology of CPU unless topology tagging is disabled
+func (p *CPUCollector) getTags(ns plugin.Namespace) map[string]string {
+	if ns[3].Value == cgroupLevel {
+		return p.cgroupTags[ns[4].Value]
+	}
+	if ns[3].Value == processLevel {
+		return p.processTags[ns[4].Value]
+	}
+	if ns[3].Value == threadLevel {
+		return p.threadTags[ns[4].Value]
+	}
+	var tags map[string]string
+	if p.topologyTags {
+		tags = p.getTopologyTags(ns[3].Value)
+	}
+	if len(ns) > minNamespaceSize && ns[4].Value == interruptsGroup {
+		for tag, val := range p.interruptsTags[ns[5].Value] {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[tag] = val
+		}
+	}
+	if len(ns) > minNamespaceSize && ns[4].Value == threadsGroup {
+		for tag, val := range p.threadTags[ns[5].Value] {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[tag] = val
+		}
+	}
+	return tags
+}
+
+// dynamicElement describes dynamic namespace element
+type dynamicElement struct {
+	name        string
+	description string
+}
+
+// groupDynamicElements dynamic namespace elements of nested per-CPU metric groups,
+// keyed by namespace element preceding the dynamic one
+var groupDynamicElements = map[string]dynamicElement{
+	interruptsGroup:       {"irq", "IRQ number or name"},
+	timeInState:           {"frequency", "CPU frequency in kHz"},
+	cpuidleGroup:          {"state", "C-state identifier (e.g. state2)"},
+	threadsGroup:          {"tid", "ID of thread"},
+	schedstatDomainsGroup: {"domain", "scheduling domain of CPU (e.g. domain0)"},
+}
+
+// getGroupNamespaces walks nested per-CPU metrics group and adds namespaces of all metrics found
+// to namespaces map (keyed by namespace string to skip duplicates), keys of groups listed
+// in groupDynamicElements are replaced with dynamic elements
+func getGroupNamespaces(ns plugin.Namespace, group map[string]interface{}, namespaces map[string]plugin.Namespace) {
+	dynElement, dynamic := groupDynamicElements[ns[len(ns)-1].Value]
+	for key, v := range group {
+		subNs := append(plugin.Namespace{}, ns...)
+		if dynamic {
+			subNs = subNs.AddDynamicElement(dynElement.name, dynElement.description)
+		} else {
+			subNs = subNs.AddStaticElement(key)
+		}
+		if subGroup, ok := v.(map[string]interface{}); ok {
+			getGroupNamespaces(subNs, subGroup, namespaces)
+			continue
+		}
+		namespaces[subNs.String()] = subNs
+	}
+}
+
+// isGroupRequested checks if any of requested metrics belongs to given per-CPU group (e.g. softirqs)
+func isGroupRequested(mts []plugin.Metric, group string) bool {
+	for _, mt := range mts {
+		if len(mt.Namespace) > minNamespaceSize && mt.Namespace[4].Value == group {
+			return true
+		}
+	}
+	return false
+}
+
+// isLevelRequested checks if any of requested metrics is published under given namespace part
+// following plugin name (e.g. system, cgroup)
+func isLevelRequested(mts []plugin.Metric, level string) bool {
+	for _, mt := range mts {
+		if len(mt.Namespace) >= minNamespaceSize && mt.Namespace[3].Value == level {
+			return true
+		}
+	}
+	return false
+}
+
+// isTopologyRequested checks if any of requested metrics is aggregated per topology level (core, socket, NUMA node)
+func isTopologyRequested(mts []plugin.Metric) bool {
+	for _, mt := range mts {
+		if len(mt.Namespace) < minNamespaceSize {
+			continue
+		}
+		if _, ok := topologyLevels[mt.Namespace[3].Value]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getMetricsByNamespace gets metrics from nested map m matching namespace elements starting from ns[idx],
+// dynamic elements ("*") are expanded to all keys available on given level; metrics found
+// through dynamic elements are returned only if they have value
+func getMetricsByNamespace(m map[string]interface{}, ns plugin.Namespace, idx int, dynamic bool) ([]plugin.Metric, error) {
+	keys := []string{ns[idx].Value}
+	if ns[idx].Value == "*" {
+		dynamic = true
+		keys = keys[:0]
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+
+	metrics := []plugin.Metric{}
+	for _, key := range keys {
+		val, ok := m[key]
+		if !ok {
+			if dynamic {
+				continue
+			}
+			return nil, fmt.Errorf("Key does not exist in map {key %s}", key)
+		}
+		ns1 := make([]plugin.NamespaceElement, len(ns))
+		copy(ns1, ns)
+		ns1[idx].Value = key
+
+		subMap, isMap := val.(map[string]interface{})
+		if idx == len(ns)-1 {
+			if isMap && !dynamic {
+				return nil, fmt.Errorf("Incorrect namespace length (len = %d)", len(ns))
+			}
+			if isMap || (val == nil && dynamic) {
+				continue
+			}
+			metrics = append(metrics, plugin.Metric{Namespace: ns1, Data: val})
+			continue
+		}
+		if !isMap {
+			if dynamic {
+				continue
+			}
+			return nil, fmt.Errorf("Incorrect namespace length (len = %d)", len(ns))
+		}
+		subMetrics, err := getMetricsByNamespace(subMap, ns1, idx+1, dynamic)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, subMetrics...)
+	}
+	return metrics, nil
+}
+
 // getNamespaceMetricPart builds part of namespace specific for metric and representation type
 func getNamespaceMetricPart(metricName string, representationType string) (s string) {
 	s = metricName + "_" + representationType
 	return s
 }
 
+// boolToUint converts boolean to 1 (true) or 0 (false)
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // mapKeyExists checks if element with given key exists in map
 func mapKeyExists(key string, m map[string]float64) bool {
 	var ret = false
@@ -447,11 +1286,11 @@ func getMapValueByNamespace(m map[string]interface{}, ns []string) (val interfac
 	return val, err
 }
 
-// getInitialProcStatData gets number of CPUs and number of metrics available in /proc/stat output
-func getInitialProcStatData(path string) (cpuMetricsNumber int, procStatMetricNumber int, err error) {
+// getInitialProcStatData gets number of metrics available in /proc/stat output and checks that all CPU lines have it
+func getInitialProcStatData(path string) (procStatMetricNumber int, err error) {
 	fh, err := os.Open(path)
 	if err != nil {
-		return cpuMetricsNumber, procStatMetricNumber, err
+		return procStatMetricNumber, err
 	}
 	defer fh.Close()
 
@@ -459,20 +1298,18 @@ func getInitialProcStatData(path string) (cpuMetricsNumber int, procStatMetricNu
 	// read the first line to start the loop
 	scanErr := scanner.Scan()
 	if scanErr != true {
-		return cpuMetricsNumber, procStatMetricNumber, fmt.Errorf("Cannot read from %s", path)
+		return procStatMetricNumber, fmt.Errorf("Cannot read from %s", path)
 	}
 
 	procStatLine := strings.Fields(scanner.Text())
 	procStatMetricNumber = len(procStatLine) - 1 //without cpu identifier (e.g. cpu or cpu0)
 
-	cpuMetricsNumber = 0
 	for strings.Contains(procStatLine[0], cpuStr) {
 		// check line length, compare current length with length of the first line
 		// length of the first line = len(procStatMetricNumber) + CPU identifier
 		if len(procStatLine) != (procStatMetricNumber + 1) {
-			return cpuMetricsNumber, procStatMetricNumber, fmt.Errorf("Incorrect %s output", path)
+			return procStatMetricNumber, fmt.Errorf("Incorrect %s output", path)
 		}
-		cpuMetricsNumber++
 		// read the next line to be able to check loop condition
 		scanErr = scanner.Scan()
 		if scanErr != true {
@@ -480,5 +1317,5 @@ func getInitialProcStatData(path string) (cpuMetricsNumber int, procStatMetricNu
 		}
 		procStatLine = strings.Fields(scanner.Text())
 	}
-	return cpuMetricsNumber, procStatMetricNumber, err
+	return procStatMetricNumber, err
 }
@@ -23,9 +23,12 @@ limitations under the License.
 package cpu
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 	. "github.com/smartystreets/goconvey/convey"
@@ -52,8 +55,19 @@ const (
 	defaultFormatCpuStatIndex = 0
 	narrowFormatCpuStatIndex  = 7
 	eightColumnCpuStatIndex   = 8
+	hotplugCpuStatIndex       = 9
+	rebootCpuStatIndex        = 10
 
 	mockPath = "MockCPUInfo"
+
+	//mockProcRoot directory with mocked procfs files other than /proc/stat
+	mockProcRoot = "MockProc"
+
+	//mockSysRoot directory with mocked sysfs files
+	mockSysRoot = "MockSys"
+
+	//mockCgroupRoot directory with mocked cgroup hierarchy
+	mockCgroupRoot = "MockCgroup"
 )
 
 func (cis *CPUInfoSuite) SetupSuite() {
@@ -66,6 +80,9 @@ func (cis *CPUInfoSuite) TearDownSuite() {
 
 func removeMockCPUInfo() {
 	os.Remove(mockPath)
+	os.RemoveAll(mockProcRoot)
+	os.RemoveAll(mockSysRoot)
+	os.RemoveAll(mockCgroupRoot)
 }
 
 func TestGetStatsSuite(t *testing.T) {
@@ -75,6 +92,9 @@ func TestGetStatsSuite(t *testing.T) {
 func mockNew() *CPUCollector {
 	p := New()
 	p.proc_path = mockPath
+	p.proc_root = mockProcRoot
+	p.sys_path = mockSysRoot
+	p.cgroup_path = mockCgroupRoot
 	emptyCfg := plugin.Config{}
 	err := p.init(emptyCfg)
 	So(err, ShouldBeNil)
@@ -91,14 +111,26 @@ func loadMockCPUInfo(dataSetNumber int) {
 			cpu1 3501681 1012206 189642 49374240 11620 0 278 0 0 0
 			cpu10 3464284 998669 208226 49355234 57380 3 422 0 0 0
 			cpu11 3501681 1012206 189642 49374240 11620 0 278 0 0 0
-			intr 33594809 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0`
+			intr 33594809 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0
+			ctxt 68787473
+			btime 1475150535
+			processes 102530
+			procs_running 3
+			procs_blocked 0
+			softirq 10371525 0 4041578 1416 91402 52093 0 123 3279421 0 2905492`
 	} else if dataSetNumber == 1 {
 		content = `cpu  23472679 6048986 1215282 403105970 129312 4 2158 0 0 0
 			cpu0 3480506 1005574 209103 49472588 57381 3 424 0 0 0
 			cpu1 3516068 1019269 190413 49493320 11620 0 278 0 0 0
 			cpu10 3480506 1005574 209103 49472588 57381 3 424 0 0 0
 			cpu11 3516068 1019269 190413 49493320 11620 0 278 0 0 0
-			intr 33594809 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0`
+			intr 33604809 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0
+			ctxt 68797473
+			btime 1475150535
+			processes 102630
+			procs_running 5
+			procs_blocked 1
+			softirq 10381525 0 4045578 1416 91402 52093 0 123 3285421 0 2905492`
 	} else if dataSetNumber == 2 {
 		content = `cpu  23472670 6049996 1215282 403105970 129312 4 2158 0 0 0
 			cpu0 3480508 1005570 209105 49472590 57390 3 430 0 0 0
@@ -124,6 +156,24 @@ func loadMockCPUInfo(dataSetNumber int) {
 		content = `cpu 180401494 227200 18747745 3823269793 1561918 12082 2511349 0 0
 			cpu0 22541572 28113 2329501 477843628 173611 1735 315175 0 0
 			cpu1 23343161 22869 2630545 476714355 160618 1759 329698 0 0`
+	} else if dataSetNumber == hotplugCpuStatIndex { //data set 1 with CPU 1 offline and changed order of lines
+		content = `cpu  23472679 6048986 1215282 403105970 129312 4 2158 0 0 0
+			cpu11 3516068 1019269 190413 49493320 11620 0 278 0 0 0
+			cpu0 3480506 1005574 209103 49472588 57381 3 424 0 0 0
+			cpu10 3480506 1005574 209103 49472588 57381 3 424 0 0 0
+			intr 33604809 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0`
+	} else if dataSetNumber == rebootCpuStatIndex { //data set read after reboot, boot time changed
+		content = `cpu  2347 604 121 40310 129 0 21 0 0 0
+			cpu0 348 100 20 4947 57 0 4 0 0 0
+			cpu1 351 101 19 4949 11 0 2 0 0 0
+			cpu10 348 100 20 4947 57 0 4 0 0 0
+			cpu11 351 101 19 4949 11 0 2 0 0 0
+			intr 33594 19 2 0 0 0 0 0 9 1 4 0 0 4 0 0 0 31 0 0
+			ctxt 68787
+			btime 1475250535
+			processes 1025
+			procs_running 1
+			procs_blocked 0`
 	} else if dataSetNumber == eightColumnCpuStatIndex {
 		content = `cpu 180401494 227200 18747745 3823269793 1561918 12082 2511349 0
 			cpu0 22541572 28113 2329501 477843628 173611 1735 315175 0
@@ -140,6 +190,17 @@ func loadMockCPUInfo(dataSetNumber int) {
 	f.Write(cpuInfoContent)
 }
 
+// loadMockProcFile writes content of mocked procfs file with given name
+func loadMockProcFile(name string, content string) {
+	path := filepath.Join(mockProcRoot, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
+
 func (cis *CPUInfoSuite) TestGetMetricTypes() {
 	Convey("Given cpu info plugin initialized", cis.T(), func() {
 		p := mockNew()
@@ -152,15 +213,43 @@ func (cis *CPUInfoSuite) TestGetMetricTypes() {
 			})
 
 			Convey("Then list of metrics is returned", func() {
-				// Len mts = 24
-				// cpuMetricsNumber = 3
-				// len snapMetricsNames = 12
-				So(len(mts), ShouldEqual, len(p.snapMetricsNames)*2)
-
 				namespaces := []string{}
 				for _, m := range mts {
 					namespaces = append(namespaces, m.Namespace.String())
 				}
+				// number of metrics with namespace of given length starting with prefix
+				countNamespaces := func(prefix string, length int) int {
+					count := 0
+					for _, m := range mts {
+						if len(m.Namespace) == length && strings.HasPrefix(m.Namespace.String(), prefix) {
+							count++
+						}
+					}
+					return count
+				}
+
+				// len snapMetricsNames = 12 (jiffies, seconds, percentage and rate of each) + counter_reset
+				So(countNamespaces("/intel/procfs/cpu/*/", 5), ShouldEqual, len(p.snapMetricsNames)*4+1)
+				for _, metricName := range p.snapMetricsNames {
+					So(namespaces, ShouldContain, "/intel/procfs/cpu/*/"+getNamespaceMetricPart(metricName, secondsRepresentationType))
+					So(namespaces, ShouldContain, "/intel/procfs/cpu/*/"+getNamespaceMetricPart(metricName, rateRepresentationType))
+				}
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/*/counter_reset")
+
+				So(countNamespaces("/intel/procfs/cpu/system/", 5), ShouldEqual, len(p.sysStats))
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/system/ctxt")
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/system/ctxt_rate")
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/system/btime")
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/system/counter_reset")
+
+				So(countNamespaces("/intel/procfs/cpu/cgroup/", 6), ShouldEqual, len(cgroupMetricsNames))
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/cgroup/*/usage_percentage")
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/cgroup/*/percpu/*/usage_usec")
+				So(countNamespaces("/intel/procfs/cpu/process/", 6), ShouldEqual, len(processMetricsNames))
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/process/*/cpu_percentage")
+				So(countNamespaces("/intel/procfs/cpu/thread/", 6), ShouldEqual, len(threadMetricsNames))
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/thread/*/cpus_allowed")
+				So(namespaces, ShouldContain, "/intel/procfs/cpu/*/threads/*/cpu_percentage")
 
 				So(namespaces, ShouldContain, "/intel/procfs/cpu/*/user_percentage")
 				So(namespaces, ShouldContain, "/intel/procfs/cpu/*/nice_percentage")
@@ -375,7 +464,7 @@ func (cis *CPUInfoSuite) TestgetCPUMetrics() {
 
 			loadMockCPUInfo(0)
 
-			errStats := getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+			errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 			So(errStats, ShouldBeNil)
 
 			//all
@@ -743,7 +832,7 @@ func (cis *CPUInfoSuite) TestgetCPUMetrics() {
 
 			//get new data set from /proc/stat
 			loadMockCPUInfo(1)
-			errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+			errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 			So(errStats, ShouldBeNil)
 
 			//all
@@ -1181,11 +1270,11 @@ func (cis *CPUInfoSuite) TestgetCPUMetrics() {
 			Convey("We want to check if metric value is nil instead of negative in case of incorrect (decreasing) values in /proc/stat", func() {
 
 				loadMockCPUInfo(1)
-				errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldBeNil)
 				//get new data set to check percentage calculation for incorrect (decreasing) values in /proc/stat
 				loadMockCPUInfo(2)
-				errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldBeNil)
 
 				//all percentage
@@ -1388,15 +1477,15 @@ func (cis *CPUInfoSuite) TestgetCPUMetrics() {
 
 			Convey("We want to test getStats function with incorrect data sets", func() {
 				loadMockCPUInfo(4)
-				errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldNotBeNil)
 
 				loadMockCPUInfo(5)
-				errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldNotBeNil)
 
 				loadMockCPUInfo(6)
-				errStats = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldNotBeNil)
 			})
 		})
@@ -1409,24 +1498,390 @@ func (cis *CPUInfoSuite) TestgetInitialProcStatData() {
 		So(p, ShouldNotBeNil)
 		Convey("We want to check initial reading of /proc/stat", func() {
 			loadMockCPUInfo(1)
-			_, _, err := getInitialProcStatData(p.proc_path)
+			_, err := getInitialProcStatData(p.proc_path)
 			So(err, ShouldBeNil)
 			loadMockCPUInfo(2)
-			_, _, err = getInitialProcStatData(p.proc_path)
+			_, err = getInitialProcStatData(p.proc_path)
 			So(err, ShouldBeNil)
 			loadMockCPUInfo(3)
-			_, _, err = getInitialProcStatData(p.proc_path)
+			_, err = getInitialProcStatData(p.proc_path)
 			So(err, ShouldBeNil)
 			loadMockCPUInfo(4)
-			_, _, err = getInitialProcStatData(p.proc_path)
+			_, err = getInitialProcStatData(p.proc_path)
 			So(err, ShouldNotBeNil)
 			loadMockCPUInfo(5)
-			_, _, err = getInitialProcStatData(p.proc_path)
+			_, err = getInitialProcStatData(p.proc_path)
 			So(err, ShouldNotBeNil)
 		})
 	})
 }
 
+func (cis *CPUInfoSuite) TestCPUHotplug() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		p := mockNew()
+		So(p, ShouldNotBeNil)
+		errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
+		So(errStats, ShouldBeNil)
+		So(len(p.stats), ShouldEqual, 5)
+
+		Convey("When CPU goes offline and order of lines changes", func() {
+			loadMockCPUInfo(hotplugCpuStatIndex)
+			errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
+			So(errStats, ShouldBeNil)
+
+			Convey("Then state of offline CPU should be dropped", func() {
+				So(len(p.stats), ShouldEqual, 4)
+				So(p.stats, ShouldNotContainKey, secondCPU)
+				So(p.prevMetricsSum, ShouldNotContainKey, secondCPU)
+			})
+
+			Convey("Then metrics should be calculated for proper CPUs", func() {
+				prevSum := 3464284.0 + 998669 + 208226 + 49355234 + 57380 + 3 + 422
+				currSum := 3480506.0 + 1005574 + 209103 + 49472588 + 57381 + 3 + 424
+				val, err := getMapValueByNamespace(p.stats[firstCPU], []string{getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, 100*(3480506-3464284)/(currSum-prevSum))
+
+				prevSum = 3501681.0 + 1012206 + 189642 + 49374240 + 11620 + 0 + 278
+				currSum = 3516068.0 + 1019269 + 190413 + 49493320 + 11620 + 0 + 278
+				val, err = getMapValueByNamespace(p.stats[twelfthCPU], []string{getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, 100*(3516068-3501681)/(currSum-prevSum))
+			})
+
+			Convey("Then CPU which comes back online should be reported without percentages for the first sample", func() {
+				loadMockCPUInfo(1)
+				errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
+				So(errStats, ShouldBeNil)
+				So(len(p.stats), ShouldEqual, 5)
+				val, err := getMapValueByNamespace(p.stats[secondCPU], []string{getNamespaceMetricPart(userProcStat, jiffiesRepresentationType)})
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, 3516068)
+				val, err = getMapValueByNamespace(p.stats[secondCPU], []string{getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+				So(err, ShouldBeNil)
+				So(val, ShouldBeNil)
+			})
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCounterReset() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		p := mockNew()
+		So(p, ShouldNotBeNil)
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.sysStats[counterResetMetric], ShouldEqual, 0)
+		So(p.stats[firstCPU][counterResetMetric], ShouldEqual, 0)
+
+		Convey("When system is rebooted", func() {
+			loadMockCPUInfo(rebootCpuStatIndex)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+
+			Convey("Then counter reset should be reported for all CPUs", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 1)
+				for _, cpuID := range []string{allCPU, firstCPU, secondCPU, elevethCPU, twelfthCPU} {
+					So(p.stats[cpuID][counterResetMetric], ShouldEqual, 1)
+					So(p.stats[cpuID][getNamespaceMetricPart(userProcStat, percentageRepresentationType)], ShouldBeNil)
+					So(p.stats[cpuID][getNamespaceMetricPart(idleProcStat, percentageRepresentationType)], ShouldBeNil)
+				}
+				So(p.sysStats["ctxt_rate"], ShouldBeNil)
+			})
+
+			Convey("Then counters should be re-baselined", func() {
+				So(p.prevMetricsSum[firstCPU], ShouldEqual, 348+100+20+4947+57+0+4)
+				loadMockCPUInfo(rebootCpuStatIndex)
+				So(p.readProcStat(ts.Add(20*time.Second)), ShouldBeNil)
+				So(p.sysStats[counterResetMetric], ShouldEqual, 0)
+				So(p.stats[firstCPU][counterResetMetric], ShouldEqual, 0)
+				So(p.sysStats["ctxt_rate"], ShouldEqual, 0)
+			})
+		})
+
+		Convey("When boot time moves by a few seconds because wall clock has been stepped", func() {
+			loadMockCPUInfo(1)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+			content, err := ioutil.ReadFile(mockPath)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(mockPath, []byte(strings.Replace(string(content), "btime 1475150535", "btime 1475150532", 1)), 0644), ShouldBeNil)
+			So(p.readProcStat(ts.Add(20*time.Second)), ShouldBeNil)
+
+			Convey("Then counter reset should not be reported", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 0)
+				So(p.stats[firstCPU][counterResetMetric], ShouldEqual, 0)
+				So(p.stats[firstCPU]["user_rate"], ShouldEqual, 0)
+				So(p.sysStats["ctxt_rate"], ShouldEqual, 0)
+			})
+		})
+
+		Convey("When checkpointed container is restored on host with higher counters", func() {
+			loadMockCPUInfo(1)
+			content, err := ioutil.ReadFile(mockPath)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(mockPath, []byte(strings.Replace(string(content), "btime 1475150535", "btime 1475160535", 1)), 0644), ShouldBeNil)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+
+			Convey("Then counter reset should be reported for all CPUs", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 1)
+				for _, cpuID := range []string{allCPU, firstCPU, secondCPU} {
+					So(p.stats[cpuID][counterResetMetric], ShouldEqual, 1)
+					So(p.stats[cpuID]["user_rate"], ShouldBeNil)
+				}
+				So(p.sysStats["ctxt_rate"], ShouldBeNil)
+			})
+		})
+
+		Convey("When counters of all CPUs go down without change of boot time", func() {
+			loadMockCPUInfo(rebootCpuStatIndex)
+			content, err := ioutil.ReadFile(mockPath)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(mockPath, []byte(strings.Replace(string(content), "btime 1475250535", "btime 1475150535", 1)), 0644), ShouldBeNil)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+
+			Convey("Then counter reset should be reported for all CPUs", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 1)
+				for _, cpuID := range []string{allCPU, firstCPU, secondCPU, elevethCPU, twelfthCPU} {
+					So(p.stats[cpuID][counterResetMetric], ShouldEqual, 1)
+				}
+			})
+		})
+
+		Convey("When only counters of aggregate line go down", func() {
+			loadMockCPUInfo(1)
+			content, err := ioutil.ReadFile(mockPath)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(mockPath, []byte(strings.Replace(string(content), "403105970", "400000000", 1)), 0644), ShouldBeNil)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+
+			Convey("Then counters of other CPUs should not be re-baselined", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 0)
+				So(p.stats[allCPU][counterResetMetric], ShouldEqual, 1)
+				So(p.stats[firstCPU][counterResetMetric], ShouldEqual, 0)
+				So(p.stats[firstCPU]["user_rate"], ShouldNotBeNil)
+			})
+		})
+
+		Convey("When counters of one CPU go down", func() {
+			loadMockCPUInfo(1)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+			p.softirqsRates.rate(firstCPU+"/TIMER", 100)
+			p.softirqsRates.rate(secondCPU+"/TIMER", 100)
+			loadMockCPUInfo(2)
+			So(p.readProcStat(ts.Add(20*time.Second)), ShouldBeNil)
+
+			Convey("Then counter reset should be reported only for this CPU", func() {
+				So(p.sysStats[counterResetMetric], ShouldEqual, 0)
+				So(p.sysStats["ctxt_rate"], ShouldNotBeNil)
+				So(p.stats[secondCPU][counterResetMetric], ShouldEqual, 1)
+				So(p.stats[firstCPU][counterResetMetric], ShouldEqual, 0)
+				So(p.stats[allCPU][counterResetMetric], ShouldEqual, 0)
+				So(p.prevMetricsSum, ShouldContainKey, firstCPU)
+				So(p.softirqsRates.prev, ShouldContainKey, firstCPU+"/TIMER")
+				So(p.softirqsRates.prev, ShouldNotContainKey, secondCPU+"/TIMER")
+				So(p.prevMetricsSum[secondCPU], ShouldEqual, 3516060+1019260+190410+49493310+11610+0+270)
+			})
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCPUTimeRates() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		p := mockNew()
+		So(p, ShouldNotBeNil)
+		p.clkTck = 100
+
+		Convey("When /proc/stat is read for the first time", func() {
+			So(getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator}), ShouldBeNil)
+
+			Convey("Then rates should not be available", func() {
+				for _, cpuID := range []string{allCPU, firstCPU, secondCPU} {
+					So(p.stats[cpuID], ShouldContainKey, "user_rate")
+					So(p.stats[cpuID]["user_rate"], ShouldBeNil)
+					So(p.stats[cpuID]["utilization_rate"], ShouldBeNil)
+				}
+			})
+
+			Convey("Then rates should be calculated over elapsed time for the next read", func() {
+				loadMockCPUInfo(1)
+				So(getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, elapsed: 10, denominator: p.percentDenominator}), ShouldBeNil)
+				So(p.stats[firstCPU]["user_rate"], ShouldAlmostEqual, float64(3480506-3464284)/100/10)
+				So(p.stats[firstCPU]["steal_rate"], ShouldEqual, 0)
+				So(p.stats[allCPU]["idle_rate"], ShouldAlmostEqual, float64(403105970-402135131)/100/10)
+				So(p.stats[allCPU]["active_rate"], ShouldAlmostEqual, float64(23472679+6048986+1215282+129312+4+2158-
+					(23359837+6006716+1209900+129307+4+2156))/100/10)
+
+				Convey("And rates should not be available for counters which went down", func() {
+					loadMockCPUInfo(2)
+					So(getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, elapsed: 10, denominator: p.percentDenominator}), ShouldBeNil)
+					So(p.stats[firstCPU]["nice_rate"], ShouldBeNil)
+					So(p.stats[firstCPU]["user_rate"], ShouldAlmostEqual, 2.0/100/10)
+					So(p.stats[secondCPU]["user_rate"], ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When /proc/stat is read by collector", func() {
+			ts := time.Now()
+			So(p.readProcStat(ts), ShouldBeNil)
+			So(p.stats[firstCPU]["user_rate"], ShouldBeNil)
+			loadMockCPUInfo(1)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+
+			Convey("Then rates should be calculated over time elapsed between samples", func() {
+				So(p.stats[firstCPU]["user_rate"], ShouldAlmostEqual, float64(3480506-3464284)/100/10)
+			})
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestPercentageDenominator() {
+	Convey("Given /proc/stat with guest time of the first CPU", cis.T(), func() {
+		samples := []string{
+			`cpu  200 0 100 1600 0 0 0 0 40 0
+			cpu0 100 0 50 800 0 0 0 0 40 0
+			cpu1 100 0 50 800 0 0 0 0 0 0`,
+			`cpu  350 0 200 3300 0 0 0 0 90 0
+			cpu0 200 0 100 1600 0 0 0 0 90 0
+			cpu1 150 0 100 1700 0 0 0 0 0 0`,
+		}
+		readSamples := func(denominator string) *CPUCollector {
+			p := mockNew()
+			for _, sample := range samples {
+				So(ioutil.WriteFile(mockPath, []byte(sample), 0644), ShouldBeNil)
+				opts := cpuTimesOptions{clkTck: 100, elapsed: 10, denominator: denominator}
+				So(getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, opts), ShouldBeNil)
+			}
+			return p
+		}
+
+		Convey("When percentages are calculated over sum of all fields", func() {
+			p := readSamples(percentageDenominatorSum)
+
+			Convey("Then guest time should be counted twice", func() {
+				So(p.stats[firstCPU]["user_percentage"], ShouldAlmostEqual, 100*100.0/1000)
+				So(p.stats[firstCPU]["guest_percentage"], ShouldAlmostEqual, 100*50.0/1000)
+				So(p.stats[firstCPU]["active_jiffies"], ShouldEqual, 390)
+			})
+		})
+
+		Convey("When percentages are calculated over sum without guest time", func() {
+			p := readSamples(percentageDenominatorSumWithoutGuest)
+
+			Convey("Then guest time should be counted only in user time", func() {
+				So(p.stats[firstCPU]["user_percentage"], ShouldAlmostEqual, 100*100.0/950)
+				So(p.stats[firstCPU]["idle_percentage"], ShouldAlmostEqual, 100*800.0/950)
+				So(p.stats[firstCPU]["guest_percentage"], ShouldAlmostEqual, 100*50.0/950)
+				So(p.stats[firstCPU]["active_percentage"], ShouldAlmostEqual, 100*150.0/950)
+				So(p.stats[firstCPU]["utilization_percentage"], ShouldAlmostEqual, 100*150.0/950)
+				So(p.stats[secondCPU]["user_percentage"], ShouldAlmostEqual, 100*50.0/1000)
+			})
+
+			Convey("Then jiffies should not depend on percentage denominator", func() {
+				So(p.stats[firstCPU]["active_jiffies"], ShouldEqual, 390)
+				So(p.stats[firstCPU]["utilization_jiffies"], ShouldEqual, 390)
+				So(p.stats[allCPU]["active_jiffies"], ShouldEqual, 640)
+				So(p.prevMetricsSum[firstCPU], ShouldEqual, 1990)
+			})
+		})
+
+		Convey("When percentages are calculated over elapsed time", func() {
+			p := readSamples(percentageDenominatorElapsed)
+
+			Convey("Then capacity of CPUs should be the denominator", func() {
+				So(p.stats[firstCPU]["user_percentage"], ShouldAlmostEqual, 100*100.0/1000)
+				So(p.stats[secondCPU]["idle_percentage"], ShouldAlmostEqual, 100*900.0/1000)
+				So(p.stats[allCPU]["user_percentage"], ShouldAlmostEqual, 100*150.0/2000)
+				So(p.stats[allCPU]["active_percentage"], ShouldAlmostEqual, 100*250.0/2000)
+			})
+		})
+
+		Convey("When unknown denominator is configured", func() {
+			p := New()
+			p.proc_path = mockPath
+			cfg := plugin.Config{"percentage_denominator": "uptime"}
+
+			Convey("Then initialization should fail", func() {
+				So(p.init(cfg), ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestSystemStats() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		p := mockNew()
+		So(p, ShouldNotBeNil)
+		Convey("We want to check system-wide metrics read from /proc/stat", func() {
+			ts := time.Now()
+			errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
+			So(errStats, ShouldBeNil)
+			getSysRates(p.sysStats, p.sysRates, ts)
+
+			So(p.sysStats[ctxtProcStat], ShouldEqual, uint64(68787473))
+			So(p.sysStats[intrProcStat], ShouldEqual, uint64(33594809))
+			So(p.sysStats[processesProcStat], ShouldEqual, uint64(102530))
+			So(p.sysStats[procsRunningProcStat], ShouldEqual, uint64(3))
+			So(p.sysStats[procsBlockedProcStat], ShouldEqual, uint64(0))
+			So(p.sysStats[btimeProcStat], ShouldEqual, uint64(1475150535))
+
+			//rates are not available for the first sample
+			So(p.sysStats, ShouldContainKey, "ctxt_rate")
+			So(p.sysStats["ctxt_rate"], ShouldBeNil)
+			So(p.sysStats["intr_rate"], ShouldBeNil)
+			So(p.sysStats["processes_rate"], ShouldBeNil)
+
+			Convey("rates should be calculated for the next sample", func() {
+				loadMockCPUInfo(1)
+				errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
+				So(errStats, ShouldBeNil)
+				getSysRates(p.sysStats, p.sysRates, ts.Add(10*time.Second))
+
+				So(p.sysStats[procsRunningProcStat], ShouldEqual, uint64(5))
+				So(p.sysStats[procsBlockedProcStat], ShouldEqual, uint64(1))
+				So(p.sysStats["ctxt_rate"], ShouldEqual, 1000)
+				So(p.sysStats["intr_rate"], ShouldEqual, 1000)
+				So(p.sysStats["processes_rate"], ShouldEqual, 10)
+				loadMockCPUInfo(0)
+			})
+		})
+
+		Convey("We want to collect system-wide metrics", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, ctxtProcStat)},
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, "ctxt_rate")},
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, btimeProcStat)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			So(metrics[0].Namespace.String(), ShouldEqual, "/intel/procfs/cpu/system/ctxt")
+			So(metrics[0].Data, ShouldEqual, uint64(68787473))
+			So(metrics[1].Data, ShouldBeNil)
+			So(metrics[2].Data, ShouldEqual, uint64(1475150535))
+		})
+	})
+}
+
 func (cis *CPUInfoSuite) TestgetMapFloatValueByNamespace() {
 	Convey("Given cpu plugin initialized", cis.T(), func() {
 		Convey("We want to check getting float value from nested map", func() {
@@ -1486,9 +1941,9 @@ func (cis *CPUInfoSuite) TestReadingNarrowFormatStats() {
 			p := mockNew()
 			So(p, ShouldNotBeNil)
 			Convey("correct values should be collected", func() {
-				errStats := getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldBeNil)
-				_ = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				_ = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				ns := plugin.NewNamespace(firstCPU, getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))
 				val, err := getMapValueByNamespace(p.stats[ns.Strings()[0]], ns.Strings()[1:])
 				So(err, ShouldBeNil)
@@ -1567,11 +2022,11 @@ func (cis *CPUInfoSuite) TestReadingEightColumnStats() {
 			p := mockNew()
 			So(p, ShouldNotBeNil)
 			Convey("metrics should be parsed without errors", func() {
-				errStats := getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				errStats := getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				So(errStats, ShouldBeNil)
 			})
 			Convey("correct values should be collected", func() {
-				_ = getStats(p.proc_path, p.stats, p.prevMetricsSum, p.cpuMetricsNumber, p.snapMetricsNames, p.procStatMetricsNames)
+				_ = getStats(p.proc_path, p.stats, p.sysStats, p.prevMetricsSum, p.snapMetricsNames, p.procStatMetricsNames, cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator})
 				ns := plugin.NewNamespace(secondCPU, getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))
 				val, err := getMapValueByNamespace(p.stats[ns.Strings()[0]], ns.Strings()[1:])
 				So(err, ShouldBeNil)
@@ -0,0 +1,135 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//cpufreqGroup namespace part for CPU frequency metrics, also name of cpufreq directory in sysfs
+	cpufreqGroup = "cpufreq"
+
+	//timeInState namespace part for time spent by CPU in each frequency, also name of cpufreq statistics file
+	timeInState = "time_in_state"
+)
+
+// cpufreqFrequencies names of cpufreq files with frequencies in kHz
+var cpufreqFrequencies = []string{"scaling_cur_freq", "cpuinfo_min_freq", "cpuinfo_max_freq"}
+
+// cpufreqStrings names of cpufreq files with string values
+var cpufreqStrings = []string{"scaling_governor", "scaling_driver"}
+
+// readCpufreq reads cpufreq sysfs directory of every online CPU and attaches its frequency metrics to stats,
+// CPUs without cpufreq support are skipped
+func (p *CPUCollector) readCpufreq() error {
+	for cpuID, cpuStats := range p.stats {
+		if cpuID == allCPU || cpuStats[onlineMetric] == uint64(0) {
+			continue
+		}
+		freqStats, err := getCpufreq(filepath.Join(p.sys_path, cpuSysDir, cpuStr+cpuID, cpufreqGroup))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		cpuStats[cpufreqGroup] = freqStats
+	}
+	return nil
+}
+
+// getCpufreq reads frequencies (kHz), governor and driver from cpufreq directory of CPU,
+// and time spent in each frequency if cpufreq statistics are enabled; missing files are omitted
+func getCpufreq(dir string) (map[string]interface{}, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	freqStats := make(map[string]interface{})
+	for _, name := range cpufreqFrequencies {
+		val, err := readUintFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		freqStats[name] = val
+	}
+	for _, name := range cpufreqStrings {
+		val, err := readStringFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		freqStats[name] = val
+	}
+
+	timeInStateStats, err := getTimeInState(filepath.Join(dir, "stats", timeInState))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(timeInStateStats) > 0 {
+		freqStats[timeInState] = timeInStateStats
+	}
+	return freqStats, nil
+}
+
+/* getTimeInState parses cpufreq stats/time_in_state file:
+3500000 21530
+3000000 1127
+800000 1904835
+returns map of time spent in each frequency (in 10ms units) with frequency in kHz as key
+*/
+func getTimeInState(path string) (map[string]interface{}, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	timeInStateStats := make(map[string]interface{})
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		timeInStateStats[fields[0]] = val
+	}
+	return timeInStateStats, scanner.Err()
+}
@@ -0,0 +1,114 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockCpufreq writes mocked cpufreq sysfs directory of CPU with given identifier
+func loadMockCpufreq(cpuID string, curFreq string, timeInStateContent string) {
+	dir := cpuSysDir + "/cpu" + cpuID + "/cpufreq/"
+	loadMockSysFile(dir+"scaling_cur_freq", curFreq+"\n")
+	loadMockSysFile(dir+"cpuinfo_min_freq", "800000\n")
+	loadMockSysFile(dir+"cpuinfo_max_freq", "3500000\n")
+	loadMockSysFile(dir+"scaling_governor", "powersave\n")
+	loadMockSysFile(dir+"scaling_driver", "intel_pstate\n")
+	if timeInStateContent != "" {
+		loadMockSysFile(dir+"stats/time_in_state", timeInStateContent)
+	}
+}
+
+func (cis *CPUInfoSuite) TestCpufreq() {
+	Convey("Given cpu plugin initialized with sys_path and mocked cpufreq", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockCpufreq(firstCPU, "1200000", "3500000 21530\n3000000 1127\n800000 1904835\n")
+		loadMockCpufreq(secondCPU, "3400000", "")
+		p := New()
+		p.proc_path = mockPath
+		p.proc_root = mockProcRoot
+		err := p.init(plugin.Config{"sys_path": mockSysRoot})
+		So(err, ShouldBeNil)
+		So(p.sys_path, ShouldEqual, mockSysRoot)
+
+		Convey("frequency metrics should be read for CPUs with cpufreq support", func() {
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.readCpufreq(), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{cpufreqGroup, "scaling_cur_freq"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 1200000)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpufreqGroup, "cpuinfo_max_freq"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 3500000)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpufreqGroup, "scaling_governor"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "powersave")
+			val, err = getMapValueByNamespace(p.stats[secondCPU], []string{cpufreqGroup, "scaling_driver"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "intel_pstate")
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpufreqGroup, timeInState, "800000"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 1904835)
+
+			So(p.stats[secondCPU][cpufreqGroup], ShouldNotContainKey, timeInState)
+			So(p.stats[elevethCPU], ShouldNotContainKey, cpufreqGroup)
+			So(p.stats[allCPU], ShouldNotContainKey, cpufreqGroup)
+		})
+
+		Convey("frequency metrics should be available with dynamic frequency element", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+				if len(m.Namespace) == 7 && m.Namespace[5].Value == timeInState {
+					So(m.Namespace[6].Name, ShouldEqual, "frequency")
+				}
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpufreq/scaling_cur_freq")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpufreq/scaling_governor")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpufreq/time_in_state/*")
+		})
+
+		Convey("frequency metrics should be collected", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name).
+					AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)").
+					AddStaticElements(cpufreqGroup, "scaling_cur_freq")},
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, cpufreqGroup, timeInState).
+					AddDynamicElement("frequency", "CPU frequency in kHz")},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 5)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
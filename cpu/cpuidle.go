@@ -0,0 +1,124 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	//cpuidleGroup namespace part for C-state metrics, also name of cpuidle directory in sysfs
+	cpuidleGroup = "cpuidle"
+
+	//cstateName "name" of C-state (e.g. C1E)
+	cstateName = "name"
+
+	//cstateTime "time" spent in C-state, in microseconds
+	cstateTime = "time"
+
+	//cpuTimeKey key of sum of CPU times from /proc/stat of CPU among previous samples of C-state times
+	cpuTimeKey = "jiffies"
+)
+
+// cstateCounters names of numeric files of cpuidle state directory
+var cstateCounters = []string{"usage", cstateTime, "latency", "disable"}
+
+// readCpuidle reads cpuidle sysfs directory of every online CPU and attaches its C-state metrics to stats,
+// residency percentage is time spent in C-state since previous sample divided by CPU time of this CPU
+// since previous sample (sum of its CPU times from /proc/stat), as percentages of CPU times are calculated,
+// so time when CPU was offline is not taken into account
+func (p *CPUCollector) readCpuidle(ts time.Time) error {
+	p.cpuidleRates.sample(ts)
+	for cpuID, cpuStats := range p.stats {
+		if cpuID == allCPU || cpuStats[onlineMetric] == uint64(0) {
+			continue
+		}
+		cstates, err := getCpuidle(filepath.Join(p.sys_path, cpuSysDir, cpuStr+cpuID, cpuidleGroup))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		// CPU time since previous sample in microseconds
+		cpuTime, cpuTimeKnown := 0.0, false
+		if cpuTimeSum, ok := p.prevMetricsSum[cpuID]; ok {
+			cpuTime, cpuTimeKnown = p.cpuidleRates.delta(cpuID+"/"+cpuTimeKey, cpuTimeSum)
+			cpuTime = cpuTime / p.clkTck * 1e6
+		}
+		for state, cstateStats := range cstates {
+			stateStats := cstateStats.(map[string]interface{})
+			timeVal, ok := stateStats[cstateTime].(uint64)
+			if !ok {
+				continue
+			}
+			var percentage interface{}
+			if stateTime, ok := p.cpuidleRates.delta(cpuID+"/"+state, float64(timeVal)); ok && cpuTimeKnown && cpuTime > 0 {
+				percentage = 100 * stateTime / cpuTime
+			}
+			stateStats[getNamespaceMetricPart(cstateTime, percentageRepresentationType)] = percentage
+		}
+		cpuStats[cpuidleGroup] = cstates
+	}
+	return nil
+}
+
+// getCpuidle reads all C-states (state0, state1, ...) from cpuidle directory of CPU,
+// returns map of C-state metrics with name of state directory as key
+func getCpuidle(dir string) (map[string]interface{}, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cstates := make(map[string]interface{})
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "state") {
+			continue
+		}
+		stateDir := filepath.Join(dir, entry.Name())
+		stateStats := make(map[string]interface{})
+		name, err := readStringFile(filepath.Join(stateDir, cstateName))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			stateStats[cstateName] = name
+		}
+		for _, counter := range cstateCounters {
+			val, err := readUintFile(filepath.Join(stateDir, counter))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			stateStats[counter] = val
+		}
+		cstates[entry.Name()] = stateStats
+	}
+	return cstates, nil
+}
@@ -0,0 +1,126 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockCstate writes mocked cpuidle state directory of CPU with given identifier
+func loadMockCstate(cpuID string, state string, name string, usage string, time string) {
+	dir := cpuSysDir + "/cpu" + cpuID + "/cpuidle/" + state + "/"
+	loadMockSysFile(dir+"name", name+"\n")
+	loadMockSysFile(dir+"usage", usage+"\n")
+	loadMockSysFile(dir+"time", time+"\n")
+	loadMockSysFile(dir+"latency", "2\n")
+	loadMockSysFile(dir+"disable", "0\n")
+}
+
+func (cis *CPUInfoSuite) TestCpuidle() {
+	Convey("Given cpu plugin initialized with mocked cpuidle", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockCstate(firstCPU, "state0", "POLL", "100", "1000")
+		loadMockCstate(firstCPU, "state1", "C1", "2000", "5000000")
+		loadMockCstate(firstCPU, "state2", "C6", "300", "20000000")
+		loadMockSysFile(cpuSysDir+"/cpu0/cpuidle/driver/name", "intel_idle\n")
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readCpuidle(ts), ShouldBeNil)
+
+		Convey("C-state metrics should be read for CPUs with cpuidle support", func() {
+			So(p.stats[firstCPU], ShouldContainKey, cpuidleGroup)
+			So(p.stats[secondCPU], ShouldNotContainKey, cpuidleGroup)
+			So(p.stats[firstCPU][cpuidleGroup], ShouldNotContainKey, "driver")
+
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state2", "name"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "C6")
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state1", "usage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 2000)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state1", "latency"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 2)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state1", "time_percentage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("residency percentage should be calculated over CPU time of CPU for the next sample", func() {
+			loadMockCstate(firstCPU, "state1", "C1", "2100", "6000000")
+			loadMockCstate(firstCPU, "state2", "C6", "400", "26000000")
+			// 1000 jiffies (10 seconds) of idle time of CPU 0, while 20 seconds of wall clock time elapsed
+			content, err := ioutil.ReadFile(mockPath)
+			So(err, ShouldBeNil)
+			content = []byte(strings.Replace(string(content), "cpu0 3464284 998669 208226 49355234", "cpu0 3464284 998669 208226 49356234", 1))
+			So(ioutil.WriteFile(mockPath, content, 0644), ShouldBeNil)
+			So(p.readProcStat(ts.Add(20*time.Second)), ShouldBeNil)
+			So(p.readCpuidle(ts.Add(20*time.Second)), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state1", "time_percentage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 10)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state2", "time_percentage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 60)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state0", "time_percentage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 0)
+		})
+
+		Convey("residency percentage should not be calculated when CPU time did not advance", func() {
+			loadMockCstate(firstCPU, "state1", "C1", "2100", "6000000")
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+			So(p.readCpuidle(ts.Add(10*time.Second)), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{cpuidleGroup, "state1", "time_percentage"})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("C-state metrics should be available with dynamic state element", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+				if m.Namespace.Strings()[4] == cpuidleGroup {
+					So(m.Namespace[5].Name, ShouldEqual, "state")
+				}
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpuidle/*/time")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpuidle/*/time_percentage")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/cpuidle/*/name")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
@@ -0,0 +1,172 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//cpuinfoFile name of file in procfs with CPU inventory
+	cpuinfoFile = "cpuinfo"
+
+	//infoGroup namespace part for per-CPU inventory metrics
+	infoGroup = "info"
+
+	//processorField /proc/cpuinfo field which starts section of each CPU
+	processorField = "processor"
+)
+
+// cpuinfoField snap metric name of /proc/cpuinfo field and parser of its value
+type cpuinfoField struct {
+	name  string
+	parse func(string) (interface{}, error)
+}
+
+// cpuinfoFields /proc/cpuinfo fields published as inventory metrics, keyed by field name;
+// fields of x86, arm64 and ppc64le layouts with the same meaning share the same metric name
+var cpuinfoFields = map[string]cpuinfoField{
+	// x86
+	"vendor_id":  {"vendor", parseCpuinfoString},
+	"model name": {"model_name", parseCpuinfoString},
+	"cpu family": {"family", parseCpuinfoUint},
+	"model":      {"model", parseCpuinfoUint},
+	"stepping":   {"stepping", parseCpuinfoUint},
+	"microcode":  {"microcode", parseCpuinfoUint},
+	"cache size": {"cache_size", parseCpuinfoKB},
+	"cpu MHz":    {"mhz", parseCpuinfoFloat},
+	"bogomips":   {"bogomips", parseCpuinfoFloat},
+	"flags":      {"flags", parseCpuinfoString},
+	// arm64
+	"CPU implementer":  {"vendor", parseCpuinfoString},
+	"CPU architecture": {"family", parseCpuinfoUint},
+	"CPU variant":      {"variant", parseCpuinfoUint},
+	"CPU part":         {"model", parseCpuinfoUint},
+	"CPU revision":     {"stepping", parseCpuinfoUint},
+	"BogoMIPS":         {"bogomips", parseCpuinfoFloat},
+	"Features":         {"flags", parseCpuinfoString},
+	// ppc64le
+	"cpu":      {"model_name", parseCpuinfoString},
+	"clock":    {"mhz", parseCpuinfoMHz},
+	"revision": {"revision", parseCpuinfoString},
+}
+
+// readCpuinfo reads /proc/cpuinfo and attaches inventory metrics to stats of every CPU listed there
+func (p *CPUCollector) readCpuinfo() error {
+	cpuinfo, err := getCpuinfo(filepath.Join(p.proc_root, cpuinfoFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for cpuID, infoStats := range cpuinfo {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			continue
+		}
+		cpuStats[infoGroup] = infoStats
+	}
+	return nil
+}
+
+/* getCpuinfo parses /proc/cpuinfo output, which consists of section per CPU started with processor field:
+processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+...
+returns map of inventory metrics (see cpuinfoFields) per CPU identifier; fields which are not listed
+in cpuinfoFields, values which cannot be parsed and sections not related to any CPU
+(e.g. platform information at the end of ppc64le cpuinfo) are omitted
+*/
+func getCpuinfo(path string) (map[string]map[string]interface{}, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	cpuinfo := make(map[string]map[string]interface{})
+	var infoStats map[string]interface{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			// end of CPU section
+			infoStats = nil
+			continue
+		}
+		keyVal := strings.SplitN(line, ":", 2)
+		if len(keyVal) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(keyVal[0])
+		val := strings.TrimSpace(keyVal[1])
+
+		if key == processorField {
+			if _, err := strconv.ParseUint(val, 10, 64); err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			infoStats = make(map[string]interface{})
+			cpuinfo[val] = infoStats
+			continue
+		}
+		field, ok := cpuinfoFields[key]
+		if !ok || infoStats == nil {
+			continue
+		}
+		if parsed, err := field.parse(val); err == nil {
+			infoStats[field.name] = parsed
+		}
+	}
+	return cpuinfo, scanner.Err()
+}
+
+// parseCpuinfoString returns string value of /proc/cpuinfo field
+func parseCpuinfoString(val string) (interface{}, error) {
+	return val, nil
+}
+
+// parseCpuinfoUint parses decimal or hexadecimal (0x prefixed) integer value of /proc/cpuinfo field
+func parseCpuinfoUint(val string) (interface{}, error) {
+	return strconv.ParseUint(val, 0, 64)
+}
+
+// parseCpuinfoFloat parses floating point value of /proc/cpuinfo field
+func parseCpuinfoFloat(val string) (interface{}, error) {
+	return strconv.ParseFloat(val, 64)
+}
+
+// parseCpuinfoKB parses size in kilobytes with KB unit (e.g. "8192 KB")
+func parseCpuinfoKB(val string) (interface{}, error) {
+	return strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(val, "KB")), 10, 64)
+}
+
+// parseCpuinfoMHz parses frequency with MHz unit (e.g. "2300.000000MHz")
+func parseCpuinfoMHz(val string) (interface{}, error) {
+	return strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(val, "MHz")), 64)
+}
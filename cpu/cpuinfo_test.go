@@ -0,0 +1,128 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestGetCpuinfo() {
+	Convey("Given x86 /proc/cpuinfo", cis.T(), func() {
+		cpuinfo, err := getCpuinfo("testdata/cpuinfo_x86")
+		So(err, ShouldBeNil)
+		So(len(cpuinfo), ShouldEqual, 2)
+		So(cpuinfo[firstCPU]["vendor"], ShouldEqual, "GenuineIntel")
+		So(cpuinfo[firstCPU]["model_name"], ShouldEqual, "Intel(R) Xeon(R) Gold 6148 CPU @ 2.40GHz")
+		So(cpuinfo[firstCPU]["family"], ShouldEqual, 6)
+		So(cpuinfo[firstCPU]["model"], ShouldEqual, 85)
+		So(cpuinfo[firstCPU]["stepping"], ShouldEqual, 4)
+		So(cpuinfo[firstCPU]["microcode"], ShouldEqual, 0x2000065)
+		So(cpuinfo[firstCPU]["cache_size"], ShouldEqual, 28160)
+		So(cpuinfo[firstCPU]["bogomips"], ShouldEqual, 4800)
+		So(cpuinfo[firstCPU]["flags"], ShouldStartWith, "fpu vme de")
+		So(cpuinfo[secondCPU]["mhz"], ShouldEqual, 1000.123)
+		So(cpuinfo[firstCPU], ShouldNotContainKey, "bugs")
+	})
+
+	Convey("Given arm64 /proc/cpuinfo", cis.T(), func() {
+		cpuinfo, err := getCpuinfo("testdata/cpuinfo_arm64")
+		So(err, ShouldBeNil)
+		So(len(cpuinfo), ShouldEqual, 2)
+		So(cpuinfo[secondCPU]["vendor"], ShouldEqual, "0x41")
+		So(cpuinfo[secondCPU]["family"], ShouldEqual, 8)
+		So(cpuinfo[secondCPU]["variant"], ShouldEqual, 3)
+		So(cpuinfo[secondCPU]["model"], ShouldEqual, 0xd0c)
+		So(cpuinfo[secondCPU]["stepping"], ShouldEqual, 1)
+		So(cpuinfo[secondCPU]["bogomips"], ShouldEqual, 50)
+		So(cpuinfo[secondCPU]["flags"], ShouldStartWith, "fp asimd")
+	})
+
+	Convey("Given ppc64le /proc/cpuinfo", cis.T(), func() {
+		cpuinfo, err := getCpuinfo("testdata/cpuinfo_ppc64le")
+		So(err, ShouldBeNil)
+		So(len(cpuinfo), ShouldEqual, 2)
+		So(cpuinfo, ShouldContainKey, "8")
+		So(cpuinfo["8"]["model_name"], ShouldEqual, "POWER9, altivec supported")
+		So(cpuinfo["8"]["mhz"], ShouldEqual, 3800)
+		So(cpuinfo["8"]["revision"], ShouldEqual, "2.2 (pvr 004e 1202)")
+		Convey("platform section should not be attached to any CPU", func() {
+			So(cpuinfo["8"], ShouldNotContainKey, "model")
+		})
+	})
+
+	Convey("Given /proc/cpuinfo with incorrect processor number", cis.T(), func() {
+		loadMockProcFile(cpuinfoFile, "processor\t: x\nvendor_id\t: GenuineIntel\n")
+		_, err := getCpuinfo(mockProcRoot + "/" + cpuinfoFile)
+		So(err, ShouldNotBeNil)
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCollectCpuinfo() {
+	Convey("Given cpu plugin initialized with mocked /proc/cpuinfo", cis.T(), func() {
+		content, err := ioutil.ReadFile("testdata/cpuinfo_x86")
+		So(err, ShouldBeNil)
+		loadMockProcFile(cpuinfoFile, string(content))
+		loadMockCPUInfo(0)
+		p := mockNew()
+
+		Convey("inventory metrics should be collected for CPUs listed in /proc/cpuinfo", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, "*", infoGroup, "model")},
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, infoGroup, "vendor")},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			for _, m := range metrics {
+				if m.Namespace.Strings()[5] == "vendor" {
+					So(m.Data, ShouldEqual, "GenuineIntel")
+				} else {
+					So(m.Data, ShouldEqual, 85)
+				}
+			}
+		})
+
+		Convey("inventory metrics should be available", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/info/model_name")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/info/microcode")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/info/flags")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//openMetricsContentType content type of OpenMetrics text format
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	//cpuLabel label with identifier of CPU ('all' for aggregate)
+	cpuLabel = "cpu"
+)
+
+// Exporter serves per-CPU metrics in OpenMetrics text format, so the plugin can be scraped by Prometheus
+// without Snap; metric /intel/procfs/cpu/<cpuID>/<metric> is exposed as family cpu_<metric> with cpu label,
+// CPU times are exposed as counters in seconds and other metrics as gauges
+type Exporter struct {
+	collector *CPUCollector
+	config    plugin.Config
+	mts       []plugin.Metric
+	mutex     sync.Mutex
+}
+
+// NewExporter creates exporter of metrics of collector initialized with given configuration
+func NewExporter(collector *CPUCollector, cfg plugin.Config) *Exporter {
+	return &Exporter{collector: collector, config: cfg}
+}
+
+// ServeHTTP collects per-CPU metrics and writes them in OpenMetrics text format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// collector keeps state of previous collection, so scrapes are serialized
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var buf bytes.Buffer
+	if err := e.write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", openMetricsContentType)
+	w.Write(buf.Bytes())
+}
+
+// write collects per-CPU metrics and writes them in OpenMetrics text format to w,
+// per-CPU metric types are discovered on the first scrape
+func (e *Exporter) write(w io.Writer) error {
+	if e.mts == nil {
+		mts, err := e.collector.GetMetricTypes(e.config)
+		if err != nil {
+			return err
+		}
+		e.mts = []plugin.Metric{}
+		for _, mt := range mts {
+			if len(mt.Namespace) != minNamespaceSize || mt.Namespace[3].Value != "*" {
+				continue
+			}
+			mt.Config = e.config
+			e.mts = append(e.mts, mt)
+		}
+	}
+	if len(e.mts) == 0 {
+		_, err := io.WriteString(w, "# EOF\n")
+		return err
+	}
+	metrics, err := e.collector.CollectMetrics(e.mts)
+	if err != nil {
+		return err
+	}
+	return writeOpenMetrics(w, metrics)
+}
+
+// openMetricsSample sample of metric family with value of cpu label
+type openMetricsSample struct {
+	cpu   string
+	value float64
+}
+
+// writeOpenMetrics writes per-CPU metrics in OpenMetrics text format, families are sorted by name
+// and samples by CPU; metrics without numeric value and jiffies (exposed in seconds) are omitted
+func writeOpenMetrics(w io.Writer, metrics []plugin.Metric) error {
+	families := make(map[string][]openMetricsSample)
+	for _, m := range metrics {
+		ns := m.Namespace.Strings()
+		if len(ns) != minNamespaceSize {
+			continue
+		}
+		value, ok := toFloat(m.Data)
+		if !ok {
+			continue
+		}
+		metricName := ns[4]
+		if strings.HasSuffix(metricName, "_"+jiffiesRepresentationType) {
+			continue
+		}
+		families[metricName] = append(families[metricName], openMetricsSample{cpu: ns[3], value: value})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := Name + "_" + name
+		counter := strings.HasSuffix(name, "_"+secondsRepresentationType)
+		samples := families[name]
+		sort.Sort(byCPULabel(samples))
+
+		if counter {
+			fmt.Fprintf(w, "# TYPE %s counter\n# UNIT %s seconds\n", family, family)
+		} else {
+			fmt.Fprintf(w, "# TYPE %s gauge\n", family)
+		}
+		for _, sample := range samples {
+			sampleName := family
+			if counter {
+				sampleName += "_total"
+			}
+			if _, err := fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", sampleName, cpuLabel, sample.cpu,
+				strconv.FormatFloat(sample.value, 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// byCPULabel sorts samples by CPU identifier, aggregate of all CPUs first
+type byCPULabel []openMetricsSample
+
+func (s byCPULabel) Len() int      { return len(s) }
+func (s byCPULabel) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCPULabel) Less(i, j int) bool {
+	if s[i].cpu == allCPU || s[j].cpu == allCPU {
+		return s[i].cpu == allCPU && s[j].cpu != allCPU
+	}
+	return byNumericID{s[i].cpu, s[j].cpu}.Less(0, 1)
+}
+
+// toFloat converts numeric metric value to float64
+func toFloat(data interface{}) (float64, bool) {
+	switch val := data.(type) {
+	case float64:
+		return val, true
+	case uint64:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	}
+	return 0, false
+}
@@ -0,0 +1,86 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestWriteOpenMetrics() {
+	Convey("Given per-CPU metrics", cis.T(), func() {
+		metrics := []plugin.Metric{
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, secondCPU, "user_jiffies"), Data: float64(1250)},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, secondCPU, "user_seconds"), Data: 12.5},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, allCPU, "user_seconds"), Data: float64(25)},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, elevethCPU, "user_percentage"), Data: 12.5},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, "user_percentage"), Data: nil},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, "online"), Data: uint64(1)},
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, infoGroup, "vendor"), Data: "GenuineIntel"},
+		}
+		var buf bytes.Buffer
+		So(writeOpenMetrics(&buf, metrics), ShouldBeNil)
+		So(buf.String(), ShouldEqual, `# TYPE cpu_online gauge
+cpu_online{cpu="0"} 1
+# TYPE cpu_user_percentage gauge
+cpu_user_percentage{cpu="10"} 12.5
+# TYPE cpu_user_seconds counter
+# UNIT cpu_user_seconds seconds
+cpu_user_seconds_total{cpu="all"} 25
+cpu_user_seconds_total{cpu="1"} 12.5
+# EOF
+`)
+	})
+}
+
+func (cis *CPUInfoSuite) TestExporter() {
+	Convey("Given exporter of cpu plugin with mocked /proc/stat", cis.T(), func() {
+		loadMockCPUInfo(0)
+		cfg := plugin.Config{"proc_path": mockProcRoot}
+		content, err := ioutil.ReadFile(mockPath)
+		So(err, ShouldBeNil)
+		loadMockProcFile("stat", string(content))
+		exporter := NewExporter(New(), cfg)
+
+		Convey("metrics should be served in OpenMetrics text format", func() {
+			recorder := httptest.NewRecorder()
+			exporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Header().Get("Content-Type"), ShouldStartWith, "application/openmetrics-text")
+			body := recorder.Body.String()
+			So(body, ShouldContainSubstring, "# TYPE cpu_idle_seconds counter\n")
+			So(body, ShouldContainSubstring, `cpu_user_seconds_total{cpu="0"} 34642.84`+"\n")
+			So(strings.HasSuffix(body, "# EOF\n"), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
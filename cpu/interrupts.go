@@ -0,0 +1,161 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//interruptsFile name of file in procfs with per-CPU interrupt counters
+	interruptsFile = "interrupts"
+
+	//interruptsGroup namespace part for per-CPU interrupt metrics
+	interruptsGroup = "interrupts"
+
+	//interruptsCount namespace part for number of serviced interrupts
+	interruptsCount = "count"
+
+	//chipTag tag with name of interrupt controller (chip) handling IRQ
+	chipTag = "chip"
+
+	//deviceTag tag with description of device which uses IRQ
+	deviceTag = "device"
+)
+
+// readInterrupts reads /proc/interrupts and attaches per-CPU interrupt counters and their rates to stats,
+// chip name and device description of each IRQ are kept as tags
+func (p *CPUCollector) readInterrupts(ts time.Time) error {
+	interrupts, tags, err := getInterrupts(filepath.Join(p.proc_root, interruptsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	p.interruptsRates.sample(ts)
+	for cpuID, counters := range interrupts {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			continue
+		}
+		irqStats := make(map[string]interface{})
+		for irq, val := range counters {
+			irqStats[irq] = map[string]interface{}{
+				interruptsCount:        val,
+				rateRepresentationType: p.interruptsRates.rate(cpuID+"/"+irq, float64(val)),
+			}
+		}
+		cpuStats[interruptsGroup] = irqStats
+	}
+	p.interruptsTags = tags
+	return nil
+}
+
+/* getInterrupts parses /proc/interrupts output:
+           CPU0       CPU1
+  0:         36          0   IO-APIC   2-edge      timer
+ 24:     180263     201442   PCI-MSI 458752-edge      nvme0q0
+NMI:         12         10   Non-maskable interrupts
+ERR:          0
+returns map of interrupt counters per CPU identifier with lowercase IRQ number or name as keys
+and map of tags (chip name, device description) per IRQ; counters for "all" are summed over all CPUs,
+IRQs with single counter not related to any CPU (e.g. ERR, MIS) are reported only for "all"
+*/
+func getInterrupts(path string) (map[string]map[string]uint64, map[string]map[string]string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("Cannot read from %s", path)
+	}
+
+	interrupts := map[string]map[string]uint64{allCPU: make(map[string]uint64)}
+	cpuIDs := strings.Fields(scanner.Text())
+	for i := range cpuIDs {
+		cpuIDs[i] = strings.TrimPrefix(cpuIDs[i], strings.ToUpper(cpuStr))
+		interrupts[cpuIDs[i]] = make(map[string]uint64)
+	}
+	tags := make(map[string]map[string]string)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		irq := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+
+		counters := []uint64{}
+		for _, field := range fields[1:] {
+			if len(counters) == len(cpuIDs) {
+				break
+			}
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				break
+			}
+			counters = append(counters, val)
+		}
+		if len(counters) == 0 {
+			return nil, nil, fmt.Errorf("Wrong %s format", path)
+		}
+
+		interrupts[allCPU][irq] = 0
+		for i, val := range counters {
+			if len(counters) == len(cpuIDs) {
+				interrupts[cpuIDs[i]][irq] = val
+			}
+			interrupts[allCPU][irq] += val
+		}
+		tags[irq] = getInterruptTags(irq, fields[1+len(counters):])
+	}
+	return interrupts, tags, scanner.Err()
+}
+
+// getInterruptTags gets chip name and device description from the part of /proc/interrupts line following counters;
+// for numbered IRQs the first field is chip name optionally followed by hardware IRQ number and trigger type
+// (e.g. "IO-APIC 2-edge timer"), for other IRQs the whole remaining part is description (e.g. "Local timer interrupts")
+func getInterruptTags(irq string, fields []string) map[string]string {
+	tags := make(map[string]string)
+	if _, err := strconv.ParseUint(irq, 10, 64); err == nil && len(fields) > 0 {
+		tags[chipTag] = fields[0]
+		fields = fields[1:]
+		if len(fields) > 0 && fields[0][0] >= '0' && fields[0][0] <= '9' {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		tags[deviceTag] = strings.Join(fields, " ")
+	}
+	return tags
+}
@@ -0,0 +1,145 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	mockInterrupts = `            CPU0       CPU1       CPU10       CPU11
+   0:         36          0          0          0   IO-APIC   2-edge      timer
+   8:          0          1          0          0   IO-APIC   8-edge      rtc0
+  24:     180263     201442          0          0   PCI-MSI 458752-edge      nvme0q0, nvme0q1
+  30:          5          0          0          0   IO-APIC-fasteoi   ehci_hcd:usb1
+ NMI:         12         10         11          9   Non-maskable interrupts
+ LOC:    9876543    8765432    9876543    8765432   Local timer interrupts
+ ERR:          0
+ MIS:          0
+`
+	mockInterruptsNext = `            CPU0       CPU1       CPU10       CPU11
+   0:         36          0          0          0   IO-APIC   2-edge      timer
+   8:          0          1          0          0   IO-APIC   8-edge      rtc0
+  24:     181263     201442          0        500   PCI-MSI 458752-edge      nvme0q0, nvme0q1
+  30:          5          0          0          0   IO-APIC-fasteoi   ehci_hcd:usb1
+ NMI:         12         10         11          9   Non-maskable interrupts
+ LOC:    9886543    8775432    9886543    8775432   Local timer interrupts
+ ERR:          2
+ MIS:          0
+`
+)
+
+func (cis *CPUInfoSuite) TestGetInterrupts() {
+	Convey("Given /proc/interrupts output", cis.T(), func() {
+		loadMockProcFile(interruptsFile, mockInterrupts)
+		interrupts, tags, err := getInterrupts(mockProcRoot + "/" + interruptsFile)
+
+		Convey("interrupt counters should be parsed per CPU", func() {
+			So(err, ShouldBeNil)
+			So(len(interrupts), ShouldEqual, 5)
+			So(interrupts[firstCPU]["0"], ShouldEqual, 36)
+			So(interrupts[secondCPU]["24"], ShouldEqual, 201442)
+			So(interrupts[elevethCPU]["nmi"], ShouldEqual, 11)
+			So(interrupts[allCPU]["loc"], ShouldEqual, 2*(9876543+8765432))
+		})
+
+		Convey("counters not related to any CPU should be reported only for all CPUs", func() {
+			So(interrupts[allCPU], ShouldContainKey, "err")
+			So(interrupts[firstCPU], ShouldNotContainKey, "err")
+		})
+
+		Convey("chip name and device description should be parsed as tags", func() {
+			So(tags["0"], ShouldResemble, map[string]string{chipTag: "IO-APIC", deviceTag: "timer"})
+			So(tags["24"], ShouldResemble, map[string]string{chipTag: "PCI-MSI", deviceTag: "nvme0q0, nvme0q1"})
+			So(tags["30"], ShouldResemble, map[string]string{chipTag: "IO-APIC-fasteoi", deviceTag: "ehci_hcd:usb1"})
+			So(tags["loc"], ShouldResemble, map[string]string{deviceTag: "Local timer interrupts"})
+			So(tags["err"], ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCollectInterrupts() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcFile(interruptsFile, mockInterrupts)
+		p := mockNew()
+
+		Convey("interrupt metrics should be available with dynamic IRQ element", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+				if m.Namespace.Strings()[4] == interruptsGroup {
+					So(m.Namespace[5].Name, ShouldEqual, "irq")
+				}
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/interrupts/*/count")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/interrupts/*/rate")
+		})
+
+		Convey("interrupt counters, rates and tags should be collected", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name).
+					AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)").
+					AddStaticElement(interruptsGroup).
+					AddDynamicElement("irq", "IRQ number or name").
+					AddStaticElement(rateRepresentationType)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			// rates are not available for the first sample
+			So(metrics, ShouldBeEmpty)
+
+			loadMockProcFile(interruptsFile, mockInterruptsNext)
+			p.interruptsRates.currTime = p.interruptsRates.currTime.Add(-10 * time.Second)
+			metrics, err = p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			rates := make(map[string]float64)
+			for _, m := range metrics {
+				rates[m.Namespace.Strings()[3]+"/"+m.Namespace.Strings()[5]] = m.Data.(float64)
+				if m.Namespace.Strings()[5] == "24" {
+					So(m.Tags[chipTag], ShouldEqual, "PCI-MSI")
+					So(m.Tags[deviceTag], ShouldEqual, "nvme0q0, nvme0q1")
+				}
+			}
+			So(rates[firstCPU+"/24"], ShouldAlmostEqual, 100, 1)
+			So(rates[twelfthCPU+"/24"], ShouldAlmostEqual, 50, 1)
+			So(rates[allCPU+"/24"], ShouldAlmostEqual, 150, 1)
+			So(rates[allCPU+"/err"], ShouldAlmostEqual, 0.2, 0.1)
+			So(rates, ShouldNotContainKey, firstCPU+"/err")
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//loadavgFile name of file in procfs with load averages
+	loadavgFile = "loadavg"
+)
+
+// loadavgMetricsNames names of system-wide metrics read from /proc/loadavg, in order of fields
+var loadavgMetricsNames = []string{"loadavg_1min", "loadavg_5min", "loadavg_15min", "loadavg_runnable", "loadavg_tasks", "loadavg_last_pid"}
+
+// readLoadavg reads /proc/loadavg and attaches load averages, number of tasks and last PID to system-wide stats
+func (p *CPUCollector) readLoadavg() error {
+	loadavg, err := getLoadavg(filepath.Join(p.proc_root, loadavgFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for metricName, val := range loadavg {
+		p.sysStats[metricName] = val
+	}
+	return nil
+}
+
+/* getLoadavg parses /proc/loadavg output:
+0.20 0.18 0.12 1/80 11206
+returns map of load averages (float64) over 1, 5 and 15 minutes, number of runnable and all tasks and last PID (uint64)
+with names from loadavgMetricsNames as keys
+*/
+func getLoadavg(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Wrong %s format", path)
+	}
+	tasks := strings.SplitN(fields[3], "/", 2)
+	if len(tasks) != 2 {
+		return nil, fmt.Errorf("Wrong %s format", path)
+	}
+	fields = append(fields[:3], tasks[0], tasks[1], fields[4])
+
+	loadavg := make(map[string]interface{})
+	for i, metricName := range loadavgMetricsNames {
+		var val interface{}
+		var err error
+		if i < 3 {
+			val, err = strconv.ParseFloat(fields[i], 64)
+		} else {
+			val, err = strconv.ParseUint(fields[i], 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		loadavg[metricName] = val
+	}
+	return loadavg, nil
+}
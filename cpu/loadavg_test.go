@@ -0,0 +1,86 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestLoadavg() {
+	Convey("Given cpu plugin initialized with mocked /proc/loadavg", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcFile(loadavgFile, "0.20 0.18 0.12 1/80 11206\n")
+		p := mockNew()
+
+		Convey("load averages, number of tasks and last PID should be read", func() {
+			So(p.readLoadavg(), ShouldBeNil)
+			So(p.sysStats["loadavg_1min"], ShouldEqual, 0.2)
+			So(p.sysStats["loadavg_5min"], ShouldEqual, 0.18)
+			So(p.sysStats["loadavg_15min"], ShouldEqual, 0.12)
+			So(p.sysStats["loadavg_runnable"], ShouldEqual, uint64(1))
+			So(p.sysStats["loadavg_tasks"], ShouldEqual, uint64(80))
+			So(p.sysStats["loadavg_last_pid"], ShouldEqual, uint64(11206))
+		})
+
+		Convey("load averages should be collected as system-wide metrics", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, "loadavg_15min")},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Data, ShouldEqual, 0.12)
+		})
+
+		Convey("incorrect /proc/loadavg should return error", func() {
+			loadMockProcFile(loadavgFile, "0.20 0.18 0.12 80 11206\n")
+			So(p.readLoadavg(), ShouldNotBeNil)
+			loadMockProcFile(loadavgFile, "0.20 0.18 x 1/80 11206\n")
+			So(p.readLoadavg(), ShouldNotBeNil)
+		})
+
+		Convey("incorrect /proc/loadavg should not prevent listing of other metrics", func() {
+			loadMockProcFile(loadavgFile, "0.20 0.18 x 1/80 11206\n")
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, mt := range mts {
+				namespaces = append(namespaces, mt.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/user_jiffies")
+			So(namespaces, ShouldNotContain, "/intel/procfs/cpu/system/loadavg_1min")
+		})
+
+		Convey("missing /proc/loadavg should be skipped", func() {
+			os.RemoveAll(mockProcRoot)
+			So(p.readLoadavg(), ShouldBeNil)
+			So(p.sysStats, ShouldNotContainKey, "loadavg_1min")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	//pressureFile path in procfs of file with CPU pressure stall information
+	pressureFile = "pressure/cpu"
+
+	//pressurePrefix prefix of system-wide PSI metrics
+	pressurePrefix = "pressure"
+)
+
+// pressureAverages names of PSI averages (percent of time stalled over 10s, 60s and 300s windows)
+var pressureAverages = []string{"avg10", "avg60", "avg300"}
+
+// readPressure reads /proc/pressure/cpu and attaches pressure stall information to system-wide stats;
+// kernels without PSI support or with PSI disabled are silently skipped
+func (p *CPUCollector) readPressure() error {
+	pressure, err := getPressure(filepath.Join(p.proc_root, pressureFile))
+	if err != nil {
+		if os.IsNotExist(err) || isNotSupported(err) {
+			return nil
+		}
+		return err
+	}
+	for metricName, val := range pressure {
+		p.sysStats[metricName] = val
+	}
+	return nil
+}
+
+/* getPressure parses /proc/pressure/cpu output:
+some avg10=1.53 avg60=0.87 avg300=0.72 total=1271253
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+returns map of averages (float64, percent) and total stall time (uint64, microseconds) with names
+in format pressure_<some|full>_<field> as keys; "full" line is not reported by older kernels
+*/
+func getPressure(path string) (map[string]interface{}, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	pressure := make(map[string]interface{})
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		kind := fields[0]
+		if kind != "some" && kind != "full" {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		values := make(map[string]string)
+		for _, field := range fields[1:] {
+			keyVal := strings.SplitN(field, "=", 2)
+			if len(keyVal) != 2 {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			values[keyVal[0]] = keyVal[1]
+		}
+		for _, avg := range pressureAverages {
+			val, err := strconv.ParseFloat(values[avg], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			pressure[strings.Join([]string{pressurePrefix, kind, avg}, "_")] = val
+		}
+		total, err := strconv.ParseUint(values["total"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Wrong %s format", path)
+		}
+		pressure[strings.Join([]string{pressurePrefix, kind, "total"}, "_")] = total
+	}
+	return pressure, scanner.Err()
+}
+
+// isNotSupported checks if error is returned for file which exists but is not supported by kernel
+// (e.g. PSI files when kernel is booted with psi=0)
+func isNotSupported(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.EOPNOTSUPP
+}
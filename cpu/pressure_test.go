@@ -0,0 +1,84 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestPressure() {
+	Convey("Given cpu plugin initialized with mocked /proc/pressure/cpu", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcFile(pressureFile, `some avg10=1.53 avg60=0.87 avg300=0.72 total=1271253
+full avg10=0.10 avg60=0.05 avg300=0.01 total=5300
+`)
+		p := mockNew()
+
+		Convey("stall averages and totals should be read for both lines", func() {
+			So(p.readPressure(), ShouldBeNil)
+			So(p.sysStats["pressure_some_avg10"], ShouldEqual, 1.53)
+			So(p.sysStats["pressure_some_avg300"], ShouldEqual, 0.72)
+			So(p.sysStats["pressure_some_total"], ShouldEqual, uint64(1271253))
+			So(p.sysStats["pressure_full_avg60"], ShouldEqual, 0.05)
+			So(p.sysStats["pressure_full_total"], ShouldEqual, uint64(5300))
+		})
+
+		Convey("file without full line should be read", func() {
+			loadMockProcFile(pressureFile, "some avg10=0.00 avg60=0.00 avg300=0.00 total=42\n")
+			So(p.readPressure(), ShouldBeNil)
+			So(p.sysStats["pressure_some_total"], ShouldEqual, uint64(42))
+			So(p.sysStats, ShouldNotContainKey, "pressure_full_total")
+
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, "pressure_some_total")},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Data, ShouldEqual, uint64(42))
+		})
+
+		Convey("missing PSI file should be skipped", func() {
+			os.RemoveAll(mockProcRoot)
+			So(p.readPressure(), ShouldBeNil)
+			So(p.sysStats, ShouldNotContainKey, "pressure_some_total")
+		})
+
+		Convey("incorrect PSI file should return error", func() {
+			loadMockProcFile(pressureFile, "some avg10=0.00 avg60 avg300=0.00 total=42\n")
+			So(p.readPressure(), ShouldNotBeNil)
+		})
+
+		Convey("PSI disabled in kernel should be recognized", func() {
+			So(isNotSupported(&os.PathError{Op: "read", Path: pressureFile, Err: syscall.EOPNOTSUPP}), ShouldBeTrue)
+			So(isNotSupported(&os.PathError{Op: "read", Path: pressureFile, Err: syscall.EACCES}), ShouldBeFalse)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
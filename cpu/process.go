@@ -0,0 +1,293 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//processLevel namespace part for per-process metrics
+	processLevel = "process"
+
+	//commTag tag with command name of process
+	commTag = "comm"
+
+	//cmdlineTag tag with command line of process
+	cmdlineTag = "cmdline"
+
+	//processUtime time spent by process in user mode (including guest time), in jiffies
+	processUtime = "utime"
+
+	//processStime time spent by process in kernel mode, in jiffies
+	processStime = "stime"
+
+	//processGuestTime time spent by process running virtual CPU of guest, in jiffies
+	processGuestTime = "guest_time"
+
+	//processProcessor CPU on which process last ran
+	processProcessor = "processor"
+
+	//processCPUPercentage namespace part for CPU usage of process as percentage of capacity of all CPUs
+	processCPUPercentage = "cpu_percentage"
+)
+
+// DefaultProcessTopN number of processes with the highest CPU usage which are reported
+var DefaultProcessTopN = int64(10)
+
+// processMetricsNames names of all per-process metrics
+var processMetricsNames = []string{processUtime, processStime, processGuestTime, processProcessor, processCPUPercentage,
+	getNamespaceMetricPart(processUtime, percentageRepresentationType), getNamespaceMetricPart(processStime, percentageRepresentationType),
+	processCpusUsed}
+
+// processSample sample of CPU times of process used to calculate its CPU usage in the next collection;
+// start time identifies process, so reused PID is not mistaken for the same process
+type processSample struct {
+	startTime uint64
+	utime     uint64
+	stime     uint64
+}
+
+// processFilter selects processes by command name
+type processFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// newProcessFilter compiles include and exclude regular expressions, empty expression is not applied
+func newProcessFilter(include string, exclude string) (processFilter, error) {
+	filter := processFilter{}
+	var err error
+	if include != "" {
+		if filter.include, err = regexp.Compile(include); err != nil {
+			return filter, fmt.Errorf("Incorrect process_include regular expression: %v", err)
+		}
+	}
+	if exclude != "" {
+		if filter.exclude, err = regexp.Compile(exclude); err != nil {
+			return filter, fmt.Errorf("Incorrect process_exclude regular expression: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+// match checks if process with given command name passes the filter
+func (f processFilter) match(comm string) bool {
+	if f.include != nil && !f.include.MatchString(comm) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(comm)
+}
+
+// processCandidate process considered for top N processes with the highest CPU usage
+type processCandidate struct {
+	pid     string
+	stats   map[string]interface{}
+	comm    string
+	diff    float64
+	hasDiff bool
+	total   uint64
+}
+
+// byCPUUsage sorts processes by CPU time used since previous collection in descending order,
+// processes without previous sample are placed after others and sorted by total CPU time
+type byCPUUsage []processCandidate
+
+func (s byCPUUsage) Len() int      { return len(s) }
+func (s byCPUUsage) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCPUUsage) Less(i, j int) bool {
+	if s[i].hasDiff != s[j].hasDiff {
+		return s[i].hasDiff
+	}
+	if s[i].diff != s[j].diff {
+		return s[i].diff > s[j].diff
+	}
+	return s[i].total > s[j].total
+}
+
+// readProcesses scans /proc/[pid]/stat of all processes matching the filter, calculates CPU usage of every process
+// since previous collection as percentage of capacity of all CPUs (calculated with the same percentage denominator
+// as percentages of CPU times) and keeps metrics of top N processes; processes without previous sample are ranked
+// after others by total CPU time
+func (p *CPUCollector) readProcesses() error {
+	pids, err := getPids(p.proc_root)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	for _, metricName := range p.procStatMetricsNames {
+		val, _ := getMapFloatValueByNamespace(p.stats[allCPU], []string{getNamespaceMetricPart(metricName, jiffiesRepresentationType)})
+		total += val
+	}
+	guest := getGuestJiffies(p.stats[allCPU])
+	opts := cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator}
+	if !p.prevProcessTime.IsZero() {
+		opts.elapsed = p.procStatTime.Sub(p.prevProcessTime).Seconds()
+	}
+	diffTotal := getPercentageDenominator(opts, total-p.prevProcessTotal, guest-p.prevProcessGuest, len(p.getOnlineCPUs()))
+
+	candidates := byCPUUsage{}
+	prevProcesses := p.prevProcesses
+	p.prevProcesses = make(map[string]processSample)
+	for _, pid := range pids {
+		comm, err := readStringFile(filepath.Join(p.proc_root, pid, "comm"))
+		if err != nil {
+			// process has already exited
+			continue
+		}
+		if !p.processFilter.match(comm) {
+			continue
+		}
+		processStats, sample, err := getProcessStat(filepath.Join(p.proc_root, pid, "stat"))
+		if err != nil {
+			// process has exited while being read (ENOENT, ESRCH or truncated file)
+			continue
+		}
+		p.prevProcesses[pid] = sample
+
+		prev, ok := prevProcesses[pid]
+		candidates = append(candidates, getProcessCandidate(pid, comm, processStats, sample, prev, ok, diffTotal))
+	}
+	p.prevProcessTotal = total
+	p.prevProcessGuest = guest
+	p.prevProcessTime = p.procStatTime
+	p.processDiffTotal = diffTotal
+
+	sort.Sort(candidates)
+	if int64(len(candidates)) > p.processTopN {
+		candidates = candidates[:p.processTopN]
+	}
+
+	p.processStats = make(map[string]interface{})
+	p.processTags = make(map[string]map[string]string)
+	for _, c := range candidates {
+		p.processStats[c.pid] = c.stats
+		tags := map[string]string{commTag: c.comm}
+		if cmdline, err := getCmdline(filepath.Join(p.proc_root, c.pid, "cmdline")); err == nil && cmdline != "" {
+			tags[cmdlineTag] = cmdline
+		}
+		p.processTags[c.pid] = tags
+	}
+	return nil
+}
+
+// getProcessCandidate sets CPU usage percentages of process (or thread) calculated from difference to previous sample
+// of the same process and jiffies of all CPUs elapsed since previous sample, percentages are nil if previous sample
+// is not available or belongs to another process with the same identifier
+func getProcessCandidate(pid string, comm string, processStats map[string]interface{}, sample processSample, prev processSample, hasPrev bool, diffTotal float64) processCandidate {
+	c := processCandidate{pid: pid, stats: processStats, comm: comm, total: sample.utime + sample.stime}
+	processStats[processCPUPercentage] = nil
+	processStats[getNamespaceMetricPart(processUtime, percentageRepresentationType)] = nil
+	processStats[getNamespaceMetricPart(processStime, percentageRepresentationType)] = nil
+	if hasPrev && prev.startTime == sample.startTime && sample.utime >= prev.utime && sample.stime >= prev.stime && diffTotal > 0 {
+		diffUtime := float64(sample.utime - prev.utime)
+		diffStime := float64(sample.stime - prev.stime)
+		c.diff, c.hasDiff = diffUtime+diffStime, true
+		processStats[processCPUPercentage] = 100 * c.diff / diffTotal
+		processStats[getNamespaceMetricPart(processUtime, percentageRepresentationType)] = 100 * diffUtime / diffTotal
+		processStats[getNamespaceMetricPart(processStime, percentageRepresentationType)] = 100 * diffStime / diffTotal
+	}
+	return c
+}
+
+// getPids returns identifiers of all processes listed in procfs
+func getPids(procRoot string) ([]string, error) {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	pids := []string{}
+	for _, entry := range entries {
+		if _, err := strconv.ParseUint(entry.Name(), 10, 64); err == nil && entry.IsDir() {
+			pids = append(pids, entry.Name())
+		}
+	}
+	return pids, nil
+}
+
+/* getProcessStat parses /proc/[pid]/stat (or /proc/[pid]/task/[tid]/stat) output:
+1234 (my proc) S 1 1234 1234 0 -1 4194560 2370 0 0 0 150 30 0 0 20 0 1 0 4242 ...
+returns map of utime, stime, guest_time (in jiffies) and processor (field 39) metrics
+and sample of CPU times used to calculate CPU usage; command name in parentheses may contain spaces and parentheses
+*/
+func getProcessStat(path string) (map[string]interface{}, processSample, error) {
+	sample := processSample{}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, sample, err
+	}
+	end := strings.LastIndex(string(content), ")")
+	if end < 0 {
+		return nil, sample, fmt.Errorf("Wrong %s format", path)
+	}
+	// fields following command name, the first one is state (field 3)
+	fields := strings.Fields(string(content[end+1:]))
+	field := func(number int) (uint64, error) {
+		if number-3 >= len(fields) {
+			return 0, fmt.Errorf("Wrong %s format", path)
+		}
+		val, err := strconv.ParseUint(fields[number-3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Wrong %s format", path)
+		}
+		return val, nil
+	}
+
+	if sample.utime, err = field(14); err != nil {
+		return nil, sample, err
+	}
+	if sample.stime, err = field(15); err != nil {
+		return nil, sample, err
+	}
+	if sample.startTime, err = field(22); err != nil {
+		return nil, sample, err
+	}
+	processStats := map[string]interface{}{
+		processUtime: sample.utime,
+		processStime: sample.stime,
+	}
+	// processor and guest time are not reported by old kernels
+	if processor, err := field(39); err == nil {
+		processStats[processProcessor] = processor
+	}
+	if guestTime, err := field(43); err == nil {
+		processStats[processGuestTime] = guestTime
+	}
+	return processStats, sample, nil
+}
+
+// getCmdline reads /proc/[pid]/cmdline and returns command line with arguments separated by spaces,
+// command line of kernel threads is empty
+func getCmdline(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.Replace(string(content), "\x00", " ", -1)), nil
+}
@@ -0,0 +1,193 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockProcess writes mocked stat, comm and cmdline files of process with given PID
+func loadMockProcess(pid string, comm string, cmdline string, utime int, stime int, startTime int, processor int) {
+	loadMockProcFile(pid+"/stat", fmt.Sprintf("%s (%s) S 1 %s %s 0 -1 4194560 2370 0 0 0 %d %d 0 0 20 0 1 0 %d "+
+		"1000 200 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 %d 0 0 0 7 0 0 0 0 0 0 0 0 0\n",
+		pid, comm, pid, pid, utime, stime, startTime, processor))
+	loadMockProcFile(pid+"/comm", comm+"\n")
+	loadMockProcFile(pid+"/cmdline", cmdline)
+}
+
+func (cis *CPUInfoSuite) TestGetProcessStat() {
+	Convey("Given /proc/[pid]/stat with parentheses and spaces in command name", cis.T(), func() {
+		loadMockProcess("200", "(sd-pam) x", "", 15, 3, 4242, 11)
+		processStats, sample, err := getProcessStat(mockProcRoot + "/200/stat")
+		So(err, ShouldBeNil)
+		So(processStats[processUtime], ShouldEqual, 15)
+		So(processStats[processStime], ShouldEqual, 3)
+		So(processStats[processProcessor], ShouldEqual, 11)
+		So(processStats[processGuestTime], ShouldEqual, 7)
+		So(sample.startTime, ShouldEqual, 4242)
+
+		Convey("truncated stat should return error", func() {
+			loadMockProcFile("200/stat", "200 (bash) S 1 200 200 0 -1 4194560 2370 0 0 0 150\n")
+			_, _, err := getProcessStat(mockProcRoot + "/200/stat")
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestProcesses() {
+	Convey("Given cpu plugin initialized with mocked processes", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcess("100", "nginx", "nginx\x00-g\x00daemon off;\x00", 1000, 500, 100, 0)
+		loadMockProcess("200", "(sd-pam) x", "", 10, 5, 200, 1)
+		loadMockProcess("300", "kworker/0:1", "", 5000, 5000, 300, 10)
+		loadMockProcFile("self/stat", "")
+		p := mockNew()
+		p.processTopN = 2
+		So(p.readProcStat(time.Now()), ShouldBeNil)
+		So(p.readProcesses(), ShouldBeNil)
+
+		Convey("processes should be ranked by total CPU time for the first collection", func() {
+			So(len(p.processStats), ShouldEqual, 2)
+			So(p.processStats, ShouldContainKey, "300")
+			So(p.processStats, ShouldContainKey, "100")
+			val, err := getMapValueByNamespace(p.processStats, []string{"100", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			So(p.processTags["100"], ShouldResemble, map[string]string{commTag: "nginx", cmdlineTag: "nginx -g daemon off;"})
+			So(p.processTags["300"], ShouldResemble, map[string]string{commTag: "kworker/0:1"})
+		})
+
+		Convey("processes should be ranked by CPU usage since previous collection", func() {
+			loadMockCPUInfo(1)
+			// 10% and 1% of jiffies of all CPUs elapsed between data sets
+			loadMockProcess("100", "nginx", "nginx\x00-g\x00daemon off;\x00", 101000, 13634, 100, 0)
+			loadMockProcess("200", "(sd-pam) x", "", 11323, 5, 200, 1)
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.readProcesses(), ShouldBeNil)
+
+			So(len(p.processStats), ShouldEqual, 2)
+			So(p.processStats, ShouldNotContainKey, "300")
+			val, err := getMapValueByNamespace(p.processStats, []string{"100", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 10, 0.001)
+			val, err = getMapValueByNamespace(p.processStats, []string{"100", getNamespaceMetricPart(processUtime, percentageRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 100*100000.0/1131340)
+			val, err = getMapValueByNamespace(p.processStats, []string{"200", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 1, 0.001)
+
+			Convey("process with reused PID should not be compared to previous process", func() {
+				loadMockProcess("200", "bash", "bash\x00", 20000, 5, 900, 1)
+				p.prevProcessTotal -= 1000
+				So(p.readProcesses(), ShouldBeNil)
+				val, err := getMapValueByNamespace(p.processStats, []string{"200", processCPUPercentage})
+				So(err, ShouldBeNil)
+				So(val, ShouldBeNil)
+				val, err = getMapValueByNamespace(p.processStats, []string{"100", processCPUPercentage})
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, 0)
+			})
+		})
+
+		Convey("CPU usage of processes should be calculated with configured percentage denominator", func() {
+			loadMockCPUInfo(1)
+			loadMockProcess("100", "nginx", "nginx\x00-g\x00daemon off;\x00", 101000, 13634, 100, 0)
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			p.clkTck = 100
+			p.percentDenominator = percentageDenominatorElapsed
+			p.prevProcessTime = p.procStatTime.Add(-1000 * time.Second)
+			So(p.readProcesses(), ShouldBeNil)
+
+			// capacity of 4 CPUs for 1000s
+			val, err := getMapValueByNamespace(p.processStats, []string{"100", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 100*(100000.0+13134)/(1000*100*4))
+		})
+
+		Convey("processes should be filtered by command name", func() {
+			filter, err := newProcessFilter("", "^kworker/")
+			So(err, ShouldBeNil)
+			p.processFilter = filter
+			So(p.readProcesses(), ShouldBeNil)
+			So(p.processStats, ShouldNotContainKey, "300")
+			So(len(p.processStats), ShouldEqual, 2)
+
+			filter, err = newProcessFilter("^nginx$", "")
+			So(err, ShouldBeNil)
+			p.processFilter = filter
+			So(p.readProcesses(), ShouldBeNil)
+			So(len(p.processStats), ShouldEqual, 1)
+			So(p.processStats, ShouldContainKey, "100")
+		})
+
+		Convey("incorrect regular expression should return error", func() {
+			_, err := newProcessFilter("(", "")
+			So(err, ShouldNotBeNil)
+			_, err = newProcessFilter("", "[")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("process which exited while being read should be skipped", func() {
+			// reading stat of exited process fails with error other than ENOENT (e.g. ESRCH)
+			loadMockProcFile("400/comm", "short-lived")
+			So(os.MkdirAll(filepath.Join(mockProcRoot, "400", "stat"), 0755), ShouldBeNil)
+			p.processTopN = 10
+			So(p.readProcesses(), ShouldBeNil)
+			So(len(p.processStats), ShouldEqual, 3)
+			So(p.processStats, ShouldNotContainKey, "400")
+		})
+
+		Convey("negative number of reported processes should be rejected", func() {
+			p := New()
+			p.proc_path = mockPath
+			So(p.init(plugin.Config{"process_top_n": int64(-1)}), ShouldNotBeNil)
+		})
+
+		Convey("per-process metrics should be collected with comm and cmdline tags", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, processLevel, "*", processUtime)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			for _, m := range metrics {
+				So(m.Tags, ShouldContainKey, commTag)
+			}
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
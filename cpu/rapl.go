@@ -0,0 +1,166 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	//powercapClassDir directory in sysfs with power capping zones
+	powercapClassDir = "class/powercap"
+
+	//raplZonePrefix prefix of RAPL zones and subzones in powercap directory (e.g. intel-rapl:0, intel-rapl:0:1)
+	raplZonePrefix = "intel-rapl:"
+
+	//raplPackagePrefix prefix of name of RAPL package zone (e.g. package-0 or package-0-die-1)
+	raplPackagePrefix = "package-"
+
+	//raplPackageDomain RAPL domain of the whole package
+	raplPackageDomain = "package"
+
+	//raplPowerSuffix suffix of name of power metric of RAPL domain, in watts
+	raplPowerSuffix = "_power"
+)
+
+// raplDomains names of RAPL subzones for which power is calculated
+var raplDomains = map[string]bool{"core": true, "uncore": true, "dram": true}
+
+// raplCounter energy counter of RAPL zone with wraparounds accumulated
+type raplCounter struct {
+	last   uint64
+	offset uint64
+}
+
+// readRapl reads energy counters of RAPL zones from powercap sysfs directory and calculates power (in watts)
+// of package, core, uncore and dram domains of every socket since previous sample taken at ts; wraparound
+// of energy counter is handled with its maximum range. Power is attached to stats of socket (if metrics
+// aggregated per socket are available), power of dies of the same package is summed.
+// Zones which energy counter is not readable (non-root user on recent kernels) are skipped
+func (p *CPUCollector) readRapl(ts time.Time) error {
+	zones, err := getRaplZones(filepath.Join(p.sys_path, powercapClassDir))
+	if err != nil {
+		return err
+	}
+
+	p.raplRates.sample(ts)
+	power := make(map[string]map[string]interface{})
+	for zone, name := range zones {
+		// package zone of subzone (e.g. intel-rapl:0 of intel-rapl:0:1)
+		packageZone := strings.Join(strings.SplitN(zone, ":", 3)[:2], ":")
+		socket, ok := getRaplSocket(zones[packageZone])
+		if !ok {
+			continue
+		}
+		domain := raplPackageDomain
+		if zone != packageZone {
+			if !raplDomains[name] {
+				continue
+			}
+			domain = name
+		}
+
+		dir := filepath.Join(p.sys_path, powercapClassDir, zone)
+		energy, err := readUintFile(filepath.Join(dir, "energy_uj"))
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				continue
+			}
+			return err
+		}
+		maxRange, err := readUintFile(filepath.Join(dir, "max_energy_range_uj"))
+		if err != nil && !os.IsNotExist(err) && !os.IsPermission(err) {
+			return err
+		}
+		counter := p.raplCounters[zone]
+		if energy < counter.last {
+			counter.offset += maxRange
+		}
+		counter.last = energy
+		p.raplCounters[zone] = counter
+
+		// rate of microjoules per second converted to watts, power is not known for the first sample
+		// and when it is not known for any die of package
+		rate := p.raplRates.rate(zone, float64(counter.offset+energy))
+		if power[socket] == nil {
+			power[socket] = make(map[string]interface{})
+		}
+		sum, known := power[socket][domain]
+		if rate == nil || (known && sum == nil) {
+			power[socket][domain] = nil
+			continue
+		}
+		prev, _ := sum.(float64)
+		power[socket][domain] = prev + rate.(float64)/1e6
+	}
+
+	for socket, groupStats := range p.topologyStats[socketLevel] {
+		for domain, val := range power[socket] {
+			groupStats.(map[string]interface{})[domain+raplPowerSuffix] = val
+		}
+	}
+	return nil
+}
+
+// getRaplZones reads names of RAPL zones and subzones from powercap directory,
+// returns map of names with name of zone directory (e.g. intel-rapl:0:1) as key
+func getRaplZones(dir string) (map[string]string, error) {
+	zones := make(map[string]string)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return zones, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), raplZonePrefix) {
+			continue
+		}
+		name, err := readStringFile(filepath.Join(dir, entry.Name(), "name"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		zones[entry.Name()] = name
+	}
+	return zones, nil
+}
+
+// getRaplSocket returns identifier of socket of RAPL package zone with given name (package-0 or package-0-die-1),
+// false is returned for zones which are not package zones (e.g. psys)
+func getRaplSocket(name string) (string, bool) {
+	if !strings.HasPrefix(name, raplPackagePrefix) {
+		return "", false
+	}
+	socket := strings.SplitN(strings.TrimPrefix(name, raplPackagePrefix), "-", 2)[0]
+	if socket == "" || strings.Trim(socket, "0123456789") != "" {
+		return "", false
+	}
+	return socket, true
+}
@@ -0,0 +1,149 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockRaplZone writes mocked RAPL zone with given name, energy counter and its maximum range
+func loadMockRaplZone(zone string, name string, energy uint64, maxRange uint64) {
+	dir := powercapClassDir + "/" + zone
+	loadMockSysFile(dir+"/name", name+"\n")
+	loadMockSysFile(dir+"/energy_uj", strconv.FormatUint(energy, 10)+"\n")
+	loadMockSysFile(dir+"/max_energy_range_uj", strconv.FormatUint(maxRange, 10)+"\n")
+}
+
+// loadMockRapl writes mocked RAPL zones of sockets 0 (package, core, dram) and 1 (two dies) and psys zone,
+// energy counters are increased by given energy in microjoules
+func loadMockRapl(energy uint64) {
+	loadMockRaplZone("intel-rapl:0", "package-0", 1000000+energy, 262143328850)
+	loadMockRaplZone("intel-rapl:0:0", "core", 500000+energy/2, 262143328850)
+	loadMockRaplZone("intel-rapl:0:1", "dram", 200000+energy/4, 65712999613)
+	loadMockRaplZone("intel-rapl:1", "package-1-die-0", 1000+energy, 262143328850)
+	loadMockRaplZone("intel-rapl:2", "package-1-die-1", 2000+energy, 262143328850)
+	loadMockRaplZone("intel-rapl:3", "psys", energy, 262143328850)
+}
+
+func (cis *CPUInfoSuite) TestGetRaplSocket() {
+	Convey("Given names of RAPL zones", cis.T(), func() {
+		socket, ok := getRaplSocket("package-0")
+		So(ok, ShouldBeTrue)
+		So(socket, ShouldEqual, "0")
+		socket, ok = getRaplSocket("package-12-die-1")
+		So(ok, ShouldBeTrue)
+		So(socket, ShouldEqual, "12")
+		_, ok = getRaplSocket("psys")
+		So(ok, ShouldBeFalse)
+		_, ok = getRaplSocket("package-x")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func (cis *CPUInfoSuite) TestRapl() {
+	Convey("Given cpu plugin initialized with mocked RAPL powercap zones", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockTopology()
+		loadMockRapl(0)
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readTopology(), ShouldBeNil)
+		So(p.readRapl(ts), ShouldBeNil)
+
+		Convey("power should not be known for the first sample", func() {
+			So(p.topologyStats[socketLevel]["0"], ShouldContainKey, "package_power")
+			So(p.topologyStats[socketLevel]["0"].(map[string]interface{})["package_power"], ShouldBeNil)
+			So(p.topologyStats[socketLevel]["0"], ShouldNotContainKey, "psys_power")
+		})
+
+		Convey("power should be calculated in watts and summed over dies of package", func() {
+			// 20 J in 2 seconds
+			loadMockRapl(20000000)
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readRapl(ts.Add(2*time.Second)), ShouldBeNil)
+			socket0 := p.topologyStats[socketLevel]["0"].(map[string]interface{})
+			So(socket0["package_power"], ShouldAlmostEqual, 10)
+			So(socket0["core_power"], ShouldAlmostEqual, 5)
+			So(socket0["dram_power"], ShouldAlmostEqual, 2.5)
+			So(socket0, ShouldNotContainKey, "uncore_power")
+			So(p.topologyStats[socketLevel]["1"].(map[string]interface{})["package_power"], ShouldAlmostEqual, 20)
+
+			Convey("wraparound of energy counter should be handled with its maximum range", func() {
+				loadMockRaplZone("intel-rapl:0:1", "dram", 1000000, 65712999613)
+				So(p.readTopology(), ShouldBeNil)
+				So(p.readRapl(ts.Add(4*time.Second)), ShouldBeNil)
+				socket0 := p.topologyStats[socketLevel]["0"].(map[string]interface{})
+				So(socket0["dram_power"], ShouldAlmostEqual, float64(65712999613-5200000+1000000)/2/1e6)
+			})
+		})
+
+		Convey("energy counters going down after reboot should not be taken for wraparound", func() {
+			loadMockCPUInfo(rebootCpuStatIndex)
+			So(p.readProcStat(ts.Add(2*time.Second)), ShouldBeNil)
+			So(p.sysStats[counterResetMetric], ShouldEqual, 1)
+			loadMockRaplZone("intel-rapl:0", "package-0", 1000, 262143328850)
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readRapl(ts.Add(2*time.Second)), ShouldBeNil)
+			So(p.topologyStats[socketLevel]["0"].(map[string]interface{})["package_power"], ShouldBeNil)
+			So(p.raplCounters["intel-rapl:0"].offset, ShouldEqual, 0)
+
+			Convey("power should be calculated again for the next sample", func() {
+				loadMockRaplZone("intel-rapl:0", "package-0", 2001000, 262143328850)
+				So(p.readTopology(), ShouldBeNil)
+				So(p.readRapl(ts.Add(4*time.Second)), ShouldBeNil)
+				So(p.topologyStats[socketLevel]["0"].(map[string]interface{})["package_power"], ShouldAlmostEqual, 1)
+			})
+		})
+
+		Convey("unreadable energy counters should be skipped", func() {
+			if os.Geteuid() == 0 {
+				// permissions are not enforced for root
+				return
+			}
+			So(os.Chmod(mockSysRoot+"/"+powercapClassDir+"/intel-rapl:0/energy_uj", 0), ShouldBeNil)
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readRapl(ts.Add(time.Second)), ShouldBeNil)
+			So(p.topologyStats[socketLevel]["0"], ShouldNotContainKey, "package_power")
+		})
+
+		Convey("power metrics should be available per socket", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/socket/*/package_power")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/socket/*/dram_power")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
@@ -0,0 +1,159 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//schedDebugFile name of file in procfs with scheduler debug information (kernels older than 5.13)
+	schedDebugFile = "sched_debug"
+
+	//schedDebugSysFile path in sysfs of file with scheduler debug information (debugfs, kernels 5.13 and later)
+	schedDebugSysFile = "kernel/debug/sched/debug"
+
+	//runqueueGroup namespace part for per-CPU run queue metrics
+	runqueueGroup = "runqueue"
+
+	//nrRunning number of tasks in run queue of CPU (including the running one)
+	nrRunning = "nr_running"
+
+	//nrUninterruptible number of tasks in uninterruptible sleep accounted to CPU, may be negative for single CPU
+	nrUninterruptible = "nr_uninterruptible"
+)
+
+// readRunqueue reads per-CPU run queue length from scheduler debug information and attaches it to stats of CPUs,
+// values of all CPUs are summed; when scheduler debug information is not available (not built in kernel,
+// debugfs not mounted or not readable) system-wide number of runnable tasks from /proc/stat is reported for all CPUs
+func (p *CPUCollector) readRunqueue() error {
+	for _, cpuStats := range p.stats {
+		delete(cpuStats, runqueueGroup)
+	}
+	var runqueue map[string]map[string]interface{}
+	var err error
+	for _, path := range []string{filepath.Join(p.proc_root, schedDebugFile), filepath.Join(p.sys_path, schedDebugSysFile)} {
+		runqueue, err = getRunqueue(path)
+		if err == nil || !(os.IsNotExist(err) || os.IsPermission(err)) {
+			break
+		}
+	}
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			if cpuStats, ok := p.stats[allCPU]; ok {
+				if val, ok := p.sysStats[procsRunningProcStat]; ok {
+					cpuStats[runqueueGroup] = map[string]interface{}{nrRunning: val}
+				}
+			}
+			return nil
+		}
+		return err
+	}
+
+	running := uint64(0)
+	uninterruptible := int64(0)
+	for cpuID, cpuRunqueue := range runqueue {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			continue
+		}
+		if val, ok := cpuRunqueue[nrRunning].(uint64); ok {
+			running += val
+		}
+		if val, ok := cpuRunqueue[nrUninterruptible].(int64); ok {
+			uninterruptible += val
+		}
+		cpuStats[runqueueGroup] = cpuRunqueue
+	}
+	if cpuStats, ok := p.stats[allCPU]; ok {
+		cpuStats[runqueueGroup] = map[string]interface{}{nrRunning: running, nrUninterruptible: uninterruptible}
+	}
+	return nil
+}
+
+/* getRunqueue parses scheduler debug information, which consists of section per CPU:
+cpu#0, 2400.000 MHz
+  .nr_running                    : 2
+  .nr_switches                   : 91264743
+  .nr_uninterruptible            : -12
+  ...
+cfs_rq[0]:/
+  ...
+  .nr_running                    : 1
+returns map of run queue metrics per CPU identifier; only fields of run queue of CPU are read,
+fields of per-class and per-cgroup run queues (which follow them) are omitted
+*/
+func getRunqueue(path string) (map[string]map[string]interface{}, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	runqueue := make(map[string]map[string]interface{})
+	var cpuRunqueue map[string]interface{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "cpu#") {
+			cpuID := strings.SplitN(strings.TrimPrefix(line, "cpu#"), ",", 2)[0]
+			if _, err := strconv.ParseUint(cpuID, 10, 64); err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			cpuRunqueue = make(map[string]interface{})
+			runqueue[cpuID] = cpuRunqueue
+			continue
+		}
+		if cpuRunqueue == nil {
+			continue
+		}
+		if len(line) > 0 && line[0] != ' ' {
+			// end of fields of run queue of CPU
+			cpuRunqueue = nil
+			continue
+		}
+		keyVal := strings.SplitN(line, ":", 2)
+		if len(keyVal) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(keyVal[0]) {
+		case "." + nrRunning:
+			val, err := strconv.ParseUint(strings.TrimSpace(keyVal[1]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			cpuRunqueue[nrRunning] = val
+		case "." + nrUninterruptible:
+			val, err := strconv.ParseInt(strings.TrimSpace(keyVal[1]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			cpuRunqueue[nrUninterruptible] = val
+		}
+	}
+	return runqueue, scanner.Err()
+}
@@ -0,0 +1,130 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockSchedDebug mocked scheduler debug information of CPUs 0 and 1
+const mockSchedDebug = `Sched Debug Version: v0.11, 5.4.0 #1
+ktime                                   : 1234567.890123
+sysctl_sched
+  .sysctl_sched_latency                    : 24.000000
+
+cpu#0, 2400.000 MHz
+  .nr_running                    : 2
+  .nr_switches                   : 91264743
+  .nr_uninterruptible            : -12
+  .curr->pid                     : 1234
+
+cfs_rq[0]:/
+  .nr_running                    : 7
+
+cpu#1, 2400.000 MHz
+  .nr_running                    : 40
+  .nr_switches                   : 81264743
+  .nr_uninterruptible            : 15
+
+rt_rq[1]:
+  .rt_nr_running                 : 0
+`
+
+func (cis *CPUInfoSuite) TestGetRunqueue() {
+	Convey("Given scheduler debug information", cis.T(), func() {
+		loadMockProcFile(schedDebugFile, mockSchedDebug)
+		runqueue, err := getRunqueue(mockProcRoot + "/" + schedDebugFile)
+		So(err, ShouldBeNil)
+		So(len(runqueue), ShouldEqual, 2)
+
+		Convey("fields of run queue of CPU should be read, not fields of cfs_rq", func() {
+			So(runqueue[firstCPU][nrRunning], ShouldEqual, uint64(2))
+			So(runqueue[firstCPU][nrUninterruptible], ShouldEqual, int64(-12))
+			So(runqueue[secondCPU][nrRunning], ShouldEqual, uint64(40))
+		})
+
+		Convey("incorrect CPU identifier should return error", func() {
+			loadMockProcFile(schedDebugFile, "cpu#x\n  .nr_running : 1\n")
+			_, err := getRunqueue(mockProcRoot + "/" + schedDebugFile)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestRunqueue() {
+	Convey("Given cpu plugin initialized with mocked scheduler debug information in debugfs", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockSysFile(schedDebugSysFile, mockSchedDebug)
+		p := mockNew()
+		So(p.readProcStat(time.Now()), ShouldBeNil)
+		So(p.readRunqueue(), ShouldBeNil)
+
+		Convey("run queue length should be attached to CPUs and summed for all CPUs", func() {
+			val, err := getMapValueByNamespace(p.stats[secondCPU], []string{runqueueGroup, nrRunning})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(40))
+			val, err = getMapValueByNamespace(p.stats[allCPU], []string{runqueueGroup, nrRunning})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(42))
+			val, err = getMapValueByNamespace(p.stats[allCPU], []string{runqueueGroup, nrUninterruptible})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, int64(3))
+			So(p.stats[elevethCPU], ShouldNotContainKey, runqueueGroup)
+		})
+
+		Convey("system-wide number of runnable tasks should be reported when scheduler debug information is not available", func() {
+			os.RemoveAll(mockSysRoot)
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, "*", runqueueGroup, nrRunning)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Namespace.Strings()[3], ShouldEqual, allCPU)
+			So(metrics[0].Data, ShouldEqual, uint64(3))
+		})
+
+		Convey("run queue metrics should be available", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/runqueue/nr_running")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/runqueue/nr_uninterruptible")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
@@ -0,0 +1,248 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//schedstatFile name of file in procfs with scheduler statistics
+	schedstatFile = "schedstat"
+
+	//schedstatGroup namespace part for per-CPU scheduler statistics
+	schedstatGroup = "schedstat"
+
+	//schedstatDomainsGroup namespace part for load-balancing counters of scheduling domains of CPU
+	schedstatDomainsGroup = "domains"
+
+	//schedstatStatus system-wide metric with status of scheduler statistics
+	schedstatStatus = "schedstat_status"
+
+	//schedstatSupported status of scheduler statistics available in supported format
+	schedstatSupported = "supported"
+
+	//schedstatUnsupported status of scheduler statistics not available (kernel without CONFIG_SCHEDSTATS) or in unknown format
+	schedstatUnsupported = "unsupported"
+
+	//schedstatMinVersion the oldest supported version of /proc/schedstat format
+	schedstatMinVersion = 15
+
+	//schedstatRunTime time spent running by tasks on CPU, in nanoseconds
+	schedstatRunTime = "run_time"
+
+	//schedstatWaitTime time spent waiting on run queue of CPU by tasks, in nanoseconds
+	schedstatWaitTime = "wait_time"
+)
+
+// schedstatCPUFields names of fields of cpu<N> line of /proc/schedstat, empty name is set for legacy fields
+var schedstatCPUFields = []string{"", "", "sched_count", "sched_goidle", "ttwu_count", "ttwu_local",
+	schedstatRunTime, schedstatWaitTime, "timeslices"}
+
+// schedstatLoadBalanceFields names of load_balance() counters reported for every CPU idle type in domain<N> line,
+// version 17 reports imbalance split by its kind
+var schedstatLoadBalanceFields = map[bool][]string{
+	false: {"lb_count", "lb_balanced", "lb_failed", "lb_imbalance", "lb_gained", "lb_hot_gained", "lb_nobusyq", "lb_nobusyg"},
+	true: {"lb_count", "lb_balanced", "lb_failed", "lb_imbalance_load", "lb_imbalance_util", "lb_imbalance_task",
+		"lb_imbalance_misfit", "lb_gained", "lb_hot_gained", "lb_nobusyq", "lb_nobusyg"},
+}
+
+// schedstatDomainFields names of fields of domain<N> line following load_balance() counters
+var schedstatDomainFields = []string{"alb_count", "alb_failed", "alb_pushed", "sbe_count", "sbe_balanced", "sbe_pushed",
+	"sbf_count", "sbf_balanced", "sbf_pushed", "ttwu_wake_remote", "ttwu_move_affine", "ttwu_move_balance"}
+
+// schedstatIdleTypes number of CPU idle types for which load_balance() counters are reported
+const schedstatIdleTypes = 3
+
+// readSchedstat reads /proc/schedstat and attaches scheduler statistics to stats of CPUs, statistics of all CPUs
+// are summed; run and wait time rates (seconds per second) are calculated for sample taken at ts.
+// Status of scheduler statistics is reported as system-wide metric, so kernels without schedstat
+// or with unknown format are reported as unsupported instead of failing collection
+func (p *CPUCollector) readSchedstat(ts time.Time) error {
+	schedstat, err := getSchedstat(filepath.Join(p.proc_root, schedstatFile))
+	if err != nil {
+		if os.IsNotExist(err) || err == errSchedstatVersion {
+			p.sysStats[schedstatStatus] = schedstatUnsupported
+			return nil
+		}
+		return err
+	}
+	p.sysStats[schedstatStatus] = schedstatSupported
+
+	p.schedstatRates.sample(ts)
+	allStats := make(map[string]interface{})
+	for cpuID, cpuSchedstat := range schedstat {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			continue
+		}
+		for _, metricName := range schedstatCPUFields {
+			val, ok := cpuSchedstat[metricName].(uint64)
+			if !ok {
+				continue
+			}
+			sum, _ := allStats[metricName].(uint64)
+			allStats[metricName] = sum + val
+		}
+		setSchedstatRates(cpuID, cpuSchedstat, p.schedstatRates)
+		cpuStats[schedstatGroup] = cpuSchedstat
+	}
+	if cpuStats, ok := p.stats[allCPU]; ok && len(allStats) > 0 {
+		setSchedstatRates(allCPU, allStats, p.schedstatRates)
+		cpuStats[schedstatGroup] = allStats
+	}
+	return nil
+}
+
+// setSchedstatRates calculates run and wait time of CPU as seconds per second
+func setSchedstatRates(cpuID string, schedstat map[string]interface{}, rates *rateTracker) {
+	for _, metricName := range []string{schedstatRunTime, schedstatWaitTime} {
+		val, ok := schedstat[metricName].(uint64)
+		if !ok {
+			continue
+		}
+		rate := rates.rate(cpuID+"/"+metricName, float64(val))
+		if rate != nil {
+			rate = rate.(float64) / 1e9
+		}
+		schedstat[metricName+"_rate"] = rate
+	}
+}
+
+// errSchedstatVersion is returned for /proc/schedstat in format older than schedstatMinVersion
+var errSchedstatVersion = fmt.Errorf("Unsupported %s version", schedstatFile)
+
+/* getSchedstat parses /proc/schedstat output (version 15 and later):
+version 15
+timestamp 4296547546
+cpu0 0 0 1934571 657843 1095411 445624 339857210478 27395281512 1274560
+domain0 00000003 1207 1154 51 53 0 0 0 0 0 0 0 0 ...
+...
+returns map of scheduler statistics per CPU identifier; load-balancing counters of scheduling domains
+of CPU (summed over CPU idle types) are nested in schedstatDomainsGroup
+*/
+func getSchedstat(path string) (map[string]map[string]interface{}, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	schedstat := make(map[string]map[string]interface{})
+	version := 0
+	var cpuSchedstat map[string]interface{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch {
+		case fields[0] == "version":
+			version, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			if version < schedstatMinVersion {
+				return nil, errSchedstatVersion
+			}
+		case version == 0:
+			// version has to be known before statistics are parsed
+			return nil, errSchedstatVersion
+		case strings.HasPrefix(fields[0], cpuStr):
+			cpuID := strings.TrimPrefix(fields[0], cpuStr)
+			if len(fields)-1 < len(schedstatCPUFields) {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			cpuSchedstat = make(map[string]interface{})
+			for i, metricName := range schedstatCPUFields {
+				if metricName == "" {
+					continue
+				}
+				val, err := strconv.ParseUint(fields[i+1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("Wrong %s format", path)
+				}
+				cpuSchedstat[metricName] = val
+			}
+			cpuSchedstat[schedstatDomainsGroup] = make(map[string]interface{})
+			schedstat[cpuID] = cpuSchedstat
+		case strings.HasPrefix(fields[0], "domain"):
+			if cpuSchedstat == nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			domainStats, err := getSchedstatDomain(fields, version)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s format", path)
+			}
+			cpuSchedstat[schedstatDomainsGroup].(map[string]interface{})[fields[0]] = domainStats
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, errSchedstatVersion
+	}
+	return schedstat, nil
+}
+
+// getSchedstatDomain parses fields of domain<N> line, load_balance() counters are summed over CPU idle types;
+// since version 17 domain line contains name of domain which is skipped together with CPU mask
+func getSchedstatDomain(fields []string, version int) (map[string]interface{}, error) {
+	v17 := version >= 17
+	first := 2
+	if v17 {
+		first = 3
+	}
+	lbFields := schedstatLoadBalanceFields[v17]
+	if len(fields) < first+schedstatIdleTypes*len(lbFields)+len(schedstatDomainFields) {
+		return nil, fmt.Errorf("Too few fields in %s line", fields[0])
+	}
+	values := make([]uint64, 0, len(fields)-first)
+	for _, field := range fields[first:] {
+		val, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+
+	domainStats := make(map[string]interface{})
+	for i, metricName := range lbFields {
+		sum := uint64(0)
+		for idleType := 0; idleType < schedstatIdleTypes; idleType++ {
+			sum += values[idleType*len(lbFields)+i]
+		}
+		domainStats[metricName] = sum
+	}
+	for i, metricName := range schedstatDomainFields {
+		domainStats[metricName] = values[schedstatIdleTypes*len(lbFields)+i]
+	}
+	return domainStats, nil
+}
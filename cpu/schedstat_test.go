@@ -0,0 +1,154 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestGetSchedstat() {
+	Convey("Given /proc/schedstat version 15", cis.T(), func() {
+		schedstat, err := getSchedstat("testdata/schedstat")
+		So(err, ShouldBeNil)
+		So(len(schedstat), ShouldEqual, 2)
+		So(schedstat[firstCPU][schedstatRunTime], ShouldEqual, uint64(339857210478))
+		So(schedstat[firstCPU][schedstatWaitTime], ShouldEqual, uint64(27395281512))
+		So(schedstat[secondCPU]["timeslices"], ShouldEqual, uint64(1374560))
+		So(schedstat[secondCPU]["sched_count"], ShouldEqual, uint64(2034571))
+
+		Convey("load-balancing counters should be summed over CPU idle types", func() {
+			domains := schedstat[firstCPU][schedstatDomainsGroup].(map[string]interface{})
+			So(len(domains), ShouldEqual, 2)
+			domain0 := domains["domain0"].(map[string]interface{})
+			So(domain0["lb_count"], ShouldEqual, uint64(1+9+17))
+			So(domain0["lb_nobusyg"], ShouldEqual, uint64(8+16+24))
+			So(domain0["alb_count"], ShouldEqual, uint64(100))
+			So(domain0["ttwu_move_balance"], ShouldEqual, uint64(111))
+		})
+	})
+
+	Convey("Given /proc/schedstat version 17 with names of domains", cis.T(), func() {
+		domainLine := "domain0 SMT 00000003"
+		for i := 0; i < 3*11+12; i++ {
+			domainLine += " 1"
+		}
+		loadMockProcFile(schedstatFile, "version 17\ntimestamp 1\ncpu0 0 0 1 2 3 4 5 6 7\n"+domainLine+"\n")
+		schedstat, err := getSchedstat(mockProcRoot + "/" + schedstatFile)
+		So(err, ShouldBeNil)
+		domain0 := schedstat[firstCPU][schedstatDomainsGroup].(map[string]interface{})["domain0"].(map[string]interface{})
+		So(domain0["lb_imbalance_misfit"], ShouldEqual, uint64(3))
+		So(domain0["sbf_pushed"], ShouldEqual, uint64(1))
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+
+	Convey("Given /proc/schedstat in old or incorrect format", cis.T(), func() {
+		loadMockProcFile(schedstatFile, "version 14\ntimestamp 1\ncpu0 0 0 0 0 0 0 0 0 0 0 0 0\n")
+		_, err := getSchedstat(mockProcRoot + "/" + schedstatFile)
+		So(err, ShouldEqual, errSchedstatVersion)
+
+		loadMockProcFile(schedstatFile, "version 15\ntimestamp 1\ncpu0 0 0 1 2\n")
+		_, err = getSchedstat(mockProcRoot + "/" + schedstatFile)
+		So(err, ShouldNotBeNil)
+		So(err, ShouldNotEqual, errSchedstatVersion)
+
+		loadMockProcFile(schedstatFile, "version 15\ntimestamp 1\ncpu0 0 0 1 2 3 4 5 6 7\ndomain0 00000003 1 2 3\n")
+		_, err = getSchedstat(mockProcRoot + "/" + schedstatFile)
+		So(err, ShouldNotBeNil)
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestSchedstat() {
+	Convey("Given cpu plugin initialized with mocked /proc/schedstat", cis.T(), func() {
+		content, err := ioutil.ReadFile("testdata/schedstat")
+		So(err, ShouldBeNil)
+		loadMockProcFile(schedstatFile, string(content))
+		loadMockCPUInfo(0)
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readSchedstat(ts), ShouldBeNil)
+
+		Convey("scheduler statistics should be attached to CPUs and summed for all CPUs", func() {
+			So(p.sysStats[schedstatStatus], ShouldEqual, schedstatSupported)
+			val, err := getMapValueByNamespace(p.stats[allCPU], []string{schedstatGroup, schedstatWaitTime})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(27395281512+17395281512))
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{schedstatGroup, schedstatWaitTime + "_rate"})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("wait time rate should be calculated in seconds per second", func() {
+			loadMockProcFile(schedstatFile, "version 15\ntimestamp 1\n"+
+				"cpu0 0 0 1934571 657843 1095411 445624 339857210478 27895281512 1274560\n")
+			So(p.readSchedstat(ts.Add(2*time.Second)), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{schedstatGroup, schedstatWaitTime + "_rate"})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 0.25)
+		})
+
+		Convey("kernel without schedstat should be reported as unsupported", func() {
+			os.Remove(mockProcRoot + "/" + schedstatFile)
+			So(p.readSchedstat(ts), ShouldBeNil)
+			So(p.sysStats[schedstatStatus], ShouldEqual, schedstatUnsupported)
+
+			loadMockProcFile(schedstatFile, "version 10\ntimestamp 1\n")
+			So(p.readSchedstat(ts), ShouldBeNil)
+			So(p.sysStats[schedstatStatus], ShouldEqual, schedstatUnsupported)
+		})
+
+		Convey("scheduler statistics should be collected with dynamic domain element", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, "*", schedstatGroup, schedstatDomainsGroup, "*", "lb_failed")},
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, systemStats, schedstatStatus)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 5)
+
+			mts, err = p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/schedstat/wait_time_rate")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/schedstat/domains/*/lb_count")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
@@ -0,0 +1,120 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//softirqsFile name of file in procfs with per-CPU softirq counters
+	softirqsFile = "softirqs"
+
+	//softirqsGroup namespace part for per-CPU softirq metrics
+	softirqsGroup = "softirqs"
+)
+
+// readSoftirqs reads /proc/softirqs and attaches per-CPU softirq counters and their rates to stats,
+// kernels without /proc/softirqs are silently skipped
+func (p *CPUCollector) readSoftirqs(ts time.Time) error {
+	softirqs, err := getSoftirqs(filepath.Join(p.proc_root, softirqsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	p.softirqsRates.sample(ts)
+	for cpuID, counters := range softirqs {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			// CPU not reported by /proc/stat (e.g. possible but not present)
+			continue
+		}
+		softirqStats := make(map[string]interface{})
+		for name, val := range counters {
+			softirqStats[name] = val
+			softirqStats[getNamespaceMetricPart(name, rateRepresentationType)] = p.softirqsRates.rate(cpuID+"/"+name, float64(val))
+		}
+		cpuStats[softirqsGroup] = softirqStats
+	}
+	return nil
+}
+
+/* getSoftirqs parses /proc/softirqs output:
+                    CPU0       CPU1
+          HI:          0          1
+       TIMER:    1830592    1753414
+      NET_TX:        116        146
+...
+returns map of softirq counters per CPU identifier with lowercase softirq type names as keys,
+counters for "all" are summed over all CPUs
+*/
+func getSoftirqs(path string) (map[string]map[string]uint64, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("Cannot read from %s", path)
+	}
+
+	softirqs := map[string]map[string]uint64{allCPU: make(map[string]uint64)}
+	cpuIDs := strings.Fields(scanner.Text())
+	for i := range cpuIDs {
+		cpuIDs[i] = strings.TrimPrefix(cpuIDs[i], strings.ToUpper(cpuStr))
+		softirqs[cpuIDs[i]] = make(map[string]uint64)
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		counters := fields[1:]
+		if len(counters) != len(cpuIDs) {
+			return nil, fmt.Errorf("Wrong data length in %s. Expected {%d} is {%d}",
+				path, len(cpuIDs), len(counters))
+		}
+		softirqs[allCPU][name] = 0
+		for i, counter := range counters {
+			val, err := strconv.ParseUint(counter, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			softirqs[cpuIDs[i]][name] = val
+			softirqs[allCPU][name] += val
+		}
+	}
+	return softirqs, scanner.Err()
+}
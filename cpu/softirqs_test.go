@@ -0,0 +1,153 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	mockSoftirqs = `                    CPU0       CPU1       CPU10       CPU11
+          HI:          0          1          0          0
+       TIMER:    1830592    1753414    1830592    1753414
+      NET_TX:        116        146        116        146
+      NET_RX:      45682      52937      45682      52937
+       BLOCK:      26048          0      26048          0
+    IRQ_POLL:          0          0          0          0
+     TASKLET:         52         71         52         71
+       SCHED:     930518     893203     930518     893203
+     HRTIMER:          0          0          0          0
+         RCU:     734187     718305     734187     718305
+`
+	mockSoftirqsNext = `                    CPU0       CPU1       CPU10       CPU11
+          HI:          0          1          0          0
+       TIMER:    1830692    1753614    1830592    1753414
+      NET_TX:        116        146        116        146
+      NET_RX:      46682      52937      45682      52937
+       BLOCK:      26048          0      26048          0
+    IRQ_POLL:          0          0          0          0
+     TASKLET:         52         71         52         71
+       SCHED:     930518     893203     930518     893203
+     HRTIMER:          0          0          0          0
+         RCU:     734187     718305     734187     718305
+`
+	mockSoftirqsWrongLength = `                    CPU0       CPU1
+          HI:          0          1          0
+`
+)
+
+func (cis *CPUInfoSuite) TestGetSoftirqs() {
+	Convey("Given /proc/softirqs output", cis.T(), func() {
+		loadMockProcFile(softirqsFile, mockSoftirqs)
+
+		Convey("softirq counters should be parsed per CPU", func() {
+			softirqs, err := getSoftirqs(mockProcRoot + "/" + softirqsFile)
+			So(err, ShouldBeNil)
+			So(len(softirqs), ShouldEqual, 5)
+			So(softirqs[firstCPU]["timer"], ShouldEqual, 1830592)
+			So(softirqs[secondCPU]["net_rx"], ShouldEqual, 52937)
+			So(softirqs[twelfthCPU]["irq_poll"], ShouldEqual, 0)
+			So(softirqs[allCPU]["timer"], ShouldEqual, 2*(1830592+1753414))
+			So(softirqs[allCPU]["hi"], ShouldEqual, 1)
+		})
+
+		Convey("incorrect data length should be reported", func() {
+			loadMockProcFile(softirqsFile, mockSoftirqsWrongLength)
+			_, err := getSoftirqs(mockProcRoot + "/" + softirqsFile)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestCollectSoftirqs() {
+	Convey("Given cpu plugin initialized", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcFile(softirqsFile, mockSoftirqs)
+		p := mockNew()
+
+		Convey("softirq metrics should be available", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/softirqs/net_rx")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/softirqs/net_rx_rate")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/softirqs/rcu")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/system/softirq")
+			So(namespaces, ShouldNotContain, "/intel/procfs/cpu/*/softirqs")
+		})
+
+		Convey("softirq counters and rates should be collected", func() {
+			ts := time.Now()
+			So(p.readProcStat(ts), ShouldBeNil)
+			So(p.readSoftirqs(ts), ShouldBeNil)
+			loadMockProcFile(softirqsFile, mockSoftirqsNext)
+			So(p.readProcStat(ts.Add(10*time.Second)), ShouldBeNil)
+			So(p.readSoftirqs(ts.Add(10*time.Second)), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.stats[firstCPU], []string{softirqsGroup, "net_rx"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 46682)
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{softirqsGroup, "net_rx_rate"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 100)
+			val, err = getMapValueByNamespace(p.stats[secondCPU], []string{softirqsGroup, "timer_rate"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 20)
+			val, err = getMapValueByNamespace(p.stats[allCPU], []string{softirqsGroup, "timer_rate"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 30)
+		})
+
+		Convey("softirq metrics should be collected with dynamic CPU identifier", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name).
+					AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)").
+					AddStaticElements(softirqsGroup, "sched")},
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name, firstCPU, softirqsGroup, "net_rx")},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			// 4 CPUs + "all" and one explicitly requested metric
+			So(len(metrics), ShouldEqual, 6)
+			for _, m := range metrics {
+				So(m.Data, ShouldNotBeNil)
+				So(m.Namespace[3].Value, ShouldNotEqual, "*")
+			}
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
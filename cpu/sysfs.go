@@ -0,0 +1,135 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	//cpuSysDir directory in sysfs with CPU devices
+	cpuSysDir = "devices/system/cpu"
+
+	//onlineMetric "online" snap metric, 1 if CPU is online, 0 otherwise (number of online CPUs for "all")
+	onlineMetric = "online"
+)
+
+// DefaultSysPath root of sysfs
+var DefaultSysPath = "/sys"
+
+// readOnline reads lists of present and online CPUs from sysfs and sets "online" gauge of every present CPU;
+// offline CPUs are not reported in /proc/stat, so their stats contain only this gauge
+func (p *CPUCollector) readOnline() error {
+	online, err := getCPUList(filepath.Join(p.sys_path, cpuSysDir, "online"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	present, err := getCPUList(filepath.Join(p.sys_path, cpuSysDir, "present"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		present = online
+	}
+
+	isOnline := make(map[string]bool)
+	for _, cpuID := range online {
+		isOnline[cpuID] = true
+	}
+	for _, cpuID := range present {
+		cpuStats, ok := p.stats[cpuID]
+		if !ok {
+			cpuStats = make(map[string]interface{})
+			p.stats[cpuID] = cpuStats
+		}
+		if isOnline[cpuID] {
+			cpuStats[onlineMetric] = uint64(1)
+		} else {
+			cpuStats[onlineMetric] = uint64(0)
+		}
+	}
+	if allStats, ok := p.stats[allCPU]; ok {
+		allStats[onlineMetric] = uint64(len(online))
+	}
+	return nil
+}
+
+// readUintFile reads sysfs file with single unsigned integer value
+func readUintFile(path string) (uint64, error) {
+	content, err := readStringFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(content, 10, 64)
+}
+
+// readStringFile reads sysfs file with single string value, trailing new line is removed
+func readStringFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// getCPUList reads file with list of CPUs in sysfs format (e.g. 0-3,5,7-8) and returns CPU identifiers
+func getCPUList(path string) ([]string, error) {
+	content, err := readStringFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(content)
+}
+
+// parseCPUList parses list of CPUs in sysfs format (e.g. 0-3,5,7-8) and returns CPU identifiers
+func parseCPUList(list string) ([]string, error) {
+	cpuIDs := []string{}
+	if list == "" {
+		return cpuIDs, nil
+	}
+	for _, item := range strings.Split(list, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("Incorrect CPU list %s", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Incorrect CPU list %s", list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpuIDs = append(cpuIDs, strconv.Itoa(cpu))
+		}
+	}
+	return cpuIDs, nil
+}
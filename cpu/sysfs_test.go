@@ -0,0 +1,108 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockSysFile writes content of mocked sysfs file with given path relative to sysfs root
+func loadMockSysFile(path string, content string) {
+	path = filepath.Join(mockSysRoot, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
+
+func (cis *CPUInfoSuite) TestParseCPUList() {
+	Convey("We want to parse lists of CPUs in sysfs format", cis.T(), func() {
+		cpuIDs, err := parseCPUList("0-3,5,7-8")
+		So(err, ShouldBeNil)
+		So(cpuIDs, ShouldResemble, []string{"0", "1", "2", "3", "5", "7", "8"})
+
+		cpuIDs, err = parseCPUList("")
+		So(err, ShouldBeNil)
+		So(cpuIDs, ShouldBeEmpty)
+
+		_, err = parseCPUList("0-a")
+		So(err, ShouldNotBeNil)
+
+		_, err = parseCPUList("3-1")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func (cis *CPUInfoSuite) TestReadOnline() {
+	Convey("Given cpu plugin initialized and CPU 1 offline", cis.T(), func() {
+		loadMockCPUInfo(hotplugCpuStatIndex)
+		loadMockSysFile(cpuSysDir+"/online", "0,10-11\n")
+		loadMockSysFile(cpuSysDir+"/present", "0-1,10-11\n")
+		p := mockNew()
+
+		Convey("online gauge should be set for every present CPU", func() {
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.stats[firstCPU][onlineMetric], ShouldEqual, 1)
+			So(p.stats[twelfthCPU][onlineMetric], ShouldEqual, 1)
+			So(p.stats[secondCPU], ShouldResemble, map[string]interface{}{onlineMetric: uint64(0)})
+			So(p.stats[allCPU][onlineMetric], ShouldEqual, 3)
+		})
+
+		Convey("offline CPU should be reported only by online gauge", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name).
+					AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)").
+					AddStaticElement(onlineMetric)},
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, fs, Name).
+					AddDynamicElement("cpuID", "ID of CPU ('all' for aggregate)").
+					AddStaticElement(getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			// online gauge for 4 CPUs + "all" and user_jiffies for 3 online CPUs + "all"
+			So(len(metrics), ShouldEqual, 9)
+		})
+
+		Convey("CPU state should follow changes of online CPUs", func() {
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			loadMockCPUInfo(1)
+			loadMockSysFile(cpuSysDir+"/online", "0-1,10-11\n")
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.stats[secondCPU][onlineMetric], ShouldEqual, 1)
+			So(p.stats[secondCPU], ShouldContainKey, getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))
+			So(p.stats[allCPU][onlineMetric], ShouldEqual, 4)
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
@@ -0,0 +1,287 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//thermalThrottleDir name of directory in sysfs with thermal throttling counters of CPU
+	thermalThrottleDir = "thermal_throttle"
+
+	//thermalGroup namespace part for per-CPU thermal throttling metrics
+	thermalGroup = "thermal"
+
+	//thermalClassDir directory in sysfs with thermal zones
+	thermalClassDir = "class/thermal"
+
+	//thermalZonePrefix prefix of thermal zone directory name
+	thermalZonePrefix = "thermal_zone"
+
+	//hwmonClassDir directory in sysfs with hardware monitoring devices
+	hwmonClassDir = "class/hwmon"
+
+	//coretempHwmonName name of hwmon device with temperatures of cores and packages of x86 CPUs
+	coretempHwmonName = "coretemp"
+
+	//packageTempLabelPrefix prefix of label of sensor with temperature of package (socket), followed by logical package id
+	packageTempLabelPrefix = "Package id "
+
+	//packageTemperature temperature of package (socket), in degrees Celsius
+	packageTemperature = "package_temperature"
+
+	//packageThrottlePrefix prefix of thermal throttling counters common for all CPUs of package
+	packageThrottlePrefix = "package_"
+)
+
+// thermalThrottleCounters names of files of thermal_throttle directory of CPU
+var thermalThrottleCounters = []string{"core_throttle_count", "core_throttle_total_time_ms",
+	"package_throttle_count", "package_throttle_total_time_ms"}
+
+// packageThermalZoneTypes types of thermal zones with temperature of package (socket): x86_pkg_temp on x86,
+// cpu-thermal (or cpu_thermal) on arm64 systems with single package
+var packageThermalZoneTypes = []string{"x86_pkg_temp", "cpu-thermal", "cpu_thermal"}
+
+// readThermal reads thermal throttling counters of every online CPU and attaches them to stats;
+// if metrics aggregated per socket are available, package throttling counters (the same for all CPUs
+// of package) and temperature of package are attached to stats of socket
+func (p *CPUCollector) readThermal() error {
+	for cpuID, cpuStats := range p.stats {
+		if cpuID == allCPU || cpuStats[onlineMetric] == uint64(0) {
+			continue
+		}
+		thermalStats, err := getThermalThrottle(filepath.Join(p.sys_path, cpuSysDir, cpuStr+cpuID, thermalThrottleDir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		cpuStats[thermalGroup] = thermalStats
+	}
+
+	socketStats, ok := p.topologyStats[socketLevel]
+	if !ok {
+		return nil
+	}
+	// the first CPU of every socket
+	socketCPUs := make(map[string]string)
+	for _, cpuID := range p.getOnlineCPUs() {
+		socket := p.topology[cpuID].socket
+		if _, ok := socketCPUs[socket]; !ok && socket != "" {
+			socketCPUs[socket] = cpuID
+		}
+	}
+	for socket, cpuID := range socketCPUs {
+		groupStats, ok := socketStats[socket].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		thermalStats, ok := p.stats[cpuID][thermalGroup].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for metricName, val := range thermalStats {
+			if strings.HasPrefix(metricName, packageThrottlePrefix) {
+				groupStats[metricName] = val
+			}
+		}
+	}
+
+	// temperatures are read from package thermal zones or, if they are not available, from coretemp sensors,
+	// both are identified by logical package id which is mapped to physical_package_id of socket
+	packages := p.getLogicalPackages()
+	temperatures, err := getZoneTemperatures(filepath.Join(p.sys_path, thermalClassDir), len(packages))
+	if err != nil {
+		return err
+	}
+	if len(temperatures) == 0 {
+		if temperatures, err = getCoretempTemperatures(filepath.Join(p.sys_path, hwmonClassDir)); err != nil {
+			return err
+		}
+	}
+	for id, temperature := range temperatures {
+		if id >= len(packages) {
+			continue
+		}
+		if groupStats, ok := socketStats[packages[id]].(map[string]interface{}); ok {
+			groupStats[packageTemperature] = temperature
+		}
+	}
+	return nil
+}
+
+// getThermalThrottle reads thermal throttling counters from thermal_throttle directory of CPU,
+// missing files are omitted (e.g. package counters on platforms without package thermal management)
+func getThermalThrottle(dir string) (map[string]interface{}, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	thermalStats := make(map[string]interface{})
+	for _, name := range thermalThrottleCounters {
+		val, err := readUintFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		thermalStats[name] = val
+	}
+	return thermalStats, nil
+}
+
+// getLogicalPackages returns identifiers of packages (physical_package_id) of CPUs in order of logical package ids
+// assigned by kernel, which follow order of the first CPUs of packages
+func (p *CPUCollector) getLogicalPackages() []string {
+	cpuIDs := make([]string, 0, len(p.topology))
+	for cpuID := range p.topology {
+		cpuIDs = append(cpuIDs, cpuID)
+	}
+	sort.Sort(byNumericID(cpuIDs))
+	packages := []string{}
+	seen := make(map[string]bool)
+	for _, cpuID := range cpuIDs {
+		socket := p.topology[cpuID].socket
+		if socket == "" || seen[socket] {
+			continue
+		}
+		seen[socket] = true
+		packages = append(packages, socket)
+	}
+	return packages
+}
+
+// getZoneTemperatures reads temperatures (in degrees Celsius) of package thermal zones, returns map of temperatures
+// with logical package id as key; package thermal zones do not identify their package, they are created in order
+// of logical package ids, so nil is returned when number of package zones differs from given number of packages.
+// Zones which temperature cannot be read are omitted
+func getZoneTemperatures(dir string, packages int) (map[int]float64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	zones := []string{}
+	for _, entry := range entries {
+		zone := strings.TrimPrefix(entry.Name(), thermalZonePrefix)
+		if zone == entry.Name() || zone == "" || strings.Trim(zone, "0123456789") != "" {
+			continue
+		}
+		zoneType, err := readStringFile(filepath.Join(dir, entry.Name(), "type"))
+		if err != nil || !isPackageThermalZone(zoneType) {
+			continue
+		}
+		zones = append(zones, zone)
+	}
+	if len(zones) != packages {
+		return nil, nil
+	}
+	sort.Sort(byNumericID(zones))
+
+	temperatures := make(map[int]float64)
+	for id, zone := range zones {
+		// temperature is reported in millidegrees Celsius
+		temp, err := readStringFile(filepath.Join(dir, thermalZonePrefix+zone, "temp"))
+		if err != nil {
+			continue
+		}
+		val, err := strconv.ParseInt(temp, 10, 64)
+		if err != nil {
+			continue
+		}
+		temperatures[id] = float64(val) / 1000
+	}
+	return temperatures, nil
+}
+
+// isPackageThermalZone checks if thermal zone of given type reports temperature of package
+func isPackageThermalZone(zoneType string) bool {
+	for _, packageType := range packageThermalZoneTypes {
+		if zoneType == packageType {
+			return true
+		}
+	}
+	return false
+}
+
+/* getCoretempTemperatures reads temperatures (in degrees Celsius) of packages from hwmon devices of coretemp driver,
+sensors of packages are labeled with logical package id, e.g. for hwmon1:
+name: coretemp
+temp1_label: Package id 1
+temp1_input: 61000
+returns map of temperatures with logical package id as key; sensors which temperature cannot be read are omitted.
+On older kernels attributes of hwmon device are in its device directory
+*/
+func getCoretempTemperatures(dir string) (map[int]float64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	temperatures := make(map[int]float64)
+	for _, entry := range entries {
+		for _, deviceDir := range []string{filepath.Join(dir, entry.Name()), filepath.Join(dir, entry.Name(), "device")} {
+			name, err := readStringFile(filepath.Join(deviceDir, "name"))
+			if err != nil || name != coretempHwmonName {
+				continue
+			}
+			labels, err := filepath.Glob(filepath.Join(deviceDir, "temp*_label"))
+			if err != nil {
+				return nil, err
+			}
+			for _, labelPath := range labels {
+				label, err := readStringFile(labelPath)
+				if err != nil || !strings.HasPrefix(label, packageTempLabelPrefix) {
+					continue
+				}
+				// temperature is reported in millidegrees Celsius
+				temp, err := readStringFile(strings.TrimSuffix(labelPath, "_label") + "_input")
+				if err != nil {
+					continue
+				}
+				val, err := strconv.ParseInt(temp, 10, 64)
+				if err != nil {
+					continue
+				}
+				id, err := strconv.Atoi(strings.TrimPrefix(label, packageTempLabelPrefix))
+				if err != nil {
+					continue
+				}
+				temperatures[id] = float64(val) / 1000
+			}
+			break
+		}
+	}
+	return temperatures, nil
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockThermal writes mocked thermal throttling counters of CPUs 0, 1 (socket 0) and 10, 11 (socket 1)
+// and package thermal zones and package temperature sensors of coretemp hwmon devices of both sockets
+func loadMockThermal() {
+	for _, cpuID := range []string{firstCPU, secondCPU, elevethCPU, twelfthCPU} {
+		dir := cpuSysDir + "/cpu" + cpuID + "/" + thermalThrottleDir
+		loadMockSysFile(dir+"/core_throttle_count", cpuID+"\n")
+		loadMockSysFile(dir+"/core_throttle_total_time_ms", "15\n")
+	}
+	for _, cpuID := range []string{firstCPU, secondCPU} {
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/"+thermalThrottleDir+"/package_throttle_count", "3\n")
+	}
+	for _, cpuID := range []string{elevethCPU, twelfthCPU} {
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/"+thermalThrottleDir+"/package_throttle_count", "7\n")
+	}
+	loadMockSysFile(thermalClassDir+"/thermal_zone0/type", "acpitz\n")
+	loadMockSysFile(thermalClassDir+"/thermal_zone0/temp", "27800\n")
+	loadMockSysFile(thermalClassDir+"/thermal_zone10/type", "x86_pkg_temp\n")
+	loadMockSysFile(thermalClassDir+"/thermal_zone10/temp", "61000\n")
+	loadMockSysFile(thermalClassDir+"/thermal_zone2/type", "x86_pkg_temp\n")
+	loadMockSysFile(thermalClassDir+"/thermal_zone2/temp", "45500\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon0/name", "acpitz\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon0/temp1_input", "27800\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon1/name", "coretemp\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon1/temp1_label", "Package id 1\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon1/temp1_input", "60000\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon1/temp2_label", "Core 0\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon1/temp2_input", "59000\n")
+	// attributes of hwmon device in its device directory as on older kernels
+	loadMockSysFile(hwmonClassDir+"/hwmon2/device/name", "coretemp\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon2/device/temp1_label", "Package id 0\n")
+	loadMockSysFile(hwmonClassDir+"/hwmon2/device/temp1_input", "44000\n")
+}
+
+func (cis *CPUInfoSuite) TestThermal() {
+	Convey("Given cpu plugin initialized with mocked thermal throttling counters and temperature sensors", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockTopology()
+		loadMockThermal()
+		p := mockNew()
+		So(p.readProcStat(time.Now()), ShouldBeNil)
+
+		Convey("throttling counters should be attached to CPUs", func() {
+			So(p.readThermal(), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.stats[elevethCPU], []string{thermalGroup, "core_throttle_count"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(10))
+			val, err = getMapValueByNamespace(p.stats[firstCPU], []string{thermalGroup, "package_throttle_count"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(3))
+			So(p.stats[firstCPU][thermalGroup], ShouldNotContainKey, "package_throttle_total_time_ms")
+			So(p.stats[allCPU], ShouldNotContainKey, thermalGroup)
+		})
+
+		Convey("package counters and temperature of package thermal zones should be attached to sockets", func() {
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readThermal(), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"1", "package_throttle_count"})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, uint64(7))
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 45.5)
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"1", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 61)
+		})
+
+		Convey("logical package ids should be mapped to physical_package_id of sockets", func() {
+			for _, cpuID := range []string{firstCPU, secondCPU} {
+				loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/physical_package_id", "1\n")
+			}
+			for _, cpuID := range []string{elevethCPU, twelfthCPU} {
+				loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/physical_package_id", "0\n")
+			}
+			p := mockNew()
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readThermal(), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"1", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 45.5)
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 61)
+		})
+
+		Convey("coretemp sensors should be used when package thermal zones do not match sockets", func() {
+			os.RemoveAll(mockSysRoot + "/" + thermalClassDir + "/thermal_zone10")
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readThermal(), ShouldBeNil)
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 44)
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"1", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 60)
+		})
+
+		Convey("temperature should be attached only to sockets with package sensor", func() {
+			os.RemoveAll(mockSysRoot + "/" + thermalClassDir)
+			os.RemoveAll(mockSysRoot + "/" + hwmonClassDir + "/hwmon1")
+			So(p.readTopology(), ShouldBeNil)
+			So(p.readThermal(), ShouldBeNil)
+			So(p.topologyStats[socketLevel]["1"], ShouldNotContainKey, packageTemperature)
+			So(p.topologyStats[socketLevel]["1"], ShouldContainKey, "package_throttle_count")
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", packageTemperature})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 44)
+		})
+
+		Convey("thermal metrics should be collected per CPU and per socket", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, "*", thermalGroup, "core_throttle_total_time_ms")},
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, socketLevel, "*", packageTemperature)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 6)
+
+			mts, err = p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/thermal/core_throttle_count")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/socket/*/package_temperature")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/socket/*/package_throttle_count")
+		})
+
+		Reset(func() {
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//threadLevel namespace part for per-thread metrics
+	threadLevel = "thread"
+
+	//threadsGroup namespace part for per-CPU metrics of threads with the highest CPU usage which last ran on CPU
+	threadsGroup = "threads"
+
+	//pidTag tag with identifier of process of thread
+	pidTag = "pid"
+
+	//threadPid identifier of process of thread
+	threadPid = "pid"
+
+	//threadCpusAllowed list of CPUs on which thread is allowed to run (e.g. 0-3,8)
+	threadCpusAllowed = "cpus_allowed"
+
+	//processCpusUsed number of distinct CPUs on which threads of process which used CPU since previous collection last ran
+	processCpusUsed = "cpus_used"
+)
+
+// threadMetricsNames names of all per-thread metrics
+var threadMetricsNames = []string{threadPid, processUtime, processStime, processProcessor, processCPUPercentage,
+	getNamespaceMetricPart(processUtime, percentageRepresentationType), getNamespaceMetricPart(processStime, percentageRepresentationType),
+	threadCpusAllowed}
+
+// readThreads scans /proc/[pid]/task/[tid]/stat of threads of reported processes, keeps metrics of top N threads
+// with the highest CPU usage since previous collection and attaches them to stats of CPU on which thread last ran;
+// number of CPUs used in interval is calculated for every reported process from CPUs on which its threads
+// which used CPU since previous collection last ran
+func (p *CPUCollector) readThreads() error {
+	candidates := byCPUUsage{}
+	threadPids := make(map[string]string)
+	prevThreads := p.prevThreads
+	p.prevThreads = make(map[string]processSample)
+	for pid, processStats := range p.processStats {
+		taskDir := filepath.Join(p.proc_root, pid, "task")
+		tids, err := getPids(taskDir)
+		if err != nil {
+			// process has already exited
+			continue
+		}
+
+		cpusUsed := make(map[uint64]bool)
+		hasDiff := false
+		for _, tid := range tids {
+			threadStats, sample, err := getProcessStat(filepath.Join(taskDir, tid, "stat"))
+			if err != nil {
+				// thread has exited while being read (ENOENT, ESRCH or truncated file)
+				continue
+			}
+			comm, err := readStringFile(filepath.Join(taskDir, tid, "comm"))
+			if err != nil {
+				continue
+			}
+			cpusAllowed, err := getCpusAllowedList(filepath.Join(taskDir, tid, "status"))
+			if err != nil {
+				continue
+			}
+			threadStats[threadCpusAllowed] = cpusAllowed
+			threadStats[threadPid], _ = strconv.ParseUint(pid, 10, 64)
+			p.prevThreads[tid] = sample
+
+			prev, ok := prevThreads[tid]
+			c := getProcessCandidate(tid, comm, threadStats, sample, prev, ok, p.processDiffTotal)
+			if c.hasDiff {
+				hasDiff = true
+				if processor, ok := threadStats[processProcessor].(uint64); ok && c.diff > 0 {
+					cpusUsed[processor] = true
+				}
+			}
+			candidates = append(candidates, c)
+			threadPids[tid] = pid
+		}
+		processStats.(map[string]interface{})[processCpusUsed] = nil
+		if hasDiff {
+			processStats.(map[string]interface{})[processCpusUsed] = uint64(len(cpusUsed))
+		}
+	}
+
+	sort.Sort(candidates)
+	if int64(len(candidates)) > p.processTopN {
+		candidates = candidates[:p.processTopN]
+	}
+
+	for _, cpuStats := range p.stats {
+		delete(cpuStats, threadsGroup)
+	}
+	p.threadStats = make(map[string]interface{})
+	p.threadTags = make(map[string]map[string]string)
+	for _, c := range candidates {
+		p.threadStats[c.pid] = c.stats
+		p.threadTags[c.pid] = map[string]string{commTag: c.comm, pidTag: threadPids[c.pid]}
+
+		processor, ok := c.stats[processProcessor].(uint64)
+		if !ok {
+			continue
+		}
+		cpuStats, ok := p.stats[strconv.FormatUint(processor, 10)]
+		if !ok {
+			continue
+		}
+		threads, ok := cpuStats[threadsGroup].(map[string]interface{})
+		if !ok {
+			threads = make(map[string]interface{})
+			cpuStats[threadsGroup] = threads
+		}
+		threads[c.pid] = map[string]interface{}{processCPUPercentage: c.stats[processCPUPercentage]}
+	}
+	return nil
+}
+
+/* getCpusAllowedList parses /proc/[pid]/task/[tid]/status output:
+Name:	bash
+...
+Cpus_allowed_list:	0-3,8
+...
+returns list of CPUs on which thread is allowed to run
+*/
+func getCpusAllowedList(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		keyVal := strings.SplitN(scanner.Text(), ":", 2)
+		if len(keyVal) == 2 && keyVal[0] == "Cpus_allowed_list" {
+			return strings.TrimSpace(keyVal[1]), nil
+		}
+	}
+	return "", scanner.Err()
+}
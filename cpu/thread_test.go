@@ -0,0 +1,165 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockThread writes mocked stat, comm and status files of thread with given TID of process with given PID
+func loadMockThread(pid string, tid string, comm string, utime int, stime int, processor int, cpusAllowed string) {
+	taskDir := pid + "/task/" + tid
+	loadMockProcFile(taskDir+"/stat", fmt.Sprintf("%s (%s) S 1 %s %s 0 -1 4194560 2370 0 0 0 %d %d 0 0 20 0 1 0 %s "+
+		"1000 200 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 %d 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		tid, comm, pid, pid, utime, stime, tid, processor))
+	loadMockProcFile(taskDir+"/comm", comm+"\n")
+	loadMockProcFile(taskDir+"/status", "Name:\t"+comm+"\nState:\tS (sleeping)\nCpus_allowed:\tc03\nCpus_allowed_list:\t"+cpusAllowed+"\n")
+}
+
+func (cis *CPUInfoSuite) TestGetCpusAllowedList() {
+	Convey("Given /proc/[pid]/task/[tid]/status", cis.T(), func() {
+		loadMockThread("100", "101", "worker", 0, 0, 0, "0-1,10")
+		cpusAllowed, err := getCpusAllowedList(mockProcRoot + "/100/task/101/status")
+		So(err, ShouldBeNil)
+		So(cpusAllowed, ShouldEqual, "0-1,10")
+
+		Reset(func() {
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestThreads() {
+	Convey("Given cpu plugin initialized with mocked threads of process", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockProcess("100", "nginx", "nginx\x00", 1000, 500, 100, 0)
+		loadMockThread("100", "100", "nginx", 10, 10, 0, "0-1,10-11")
+		loadMockThread("100", "101", "worker", 500, 200, 1, "1")
+		loadMockThread("100", "102", "worker", 490, 290, 10, "10-11")
+		loadMockThread("100", "103", "idle", 0, 0, 11, "0-1,10-11")
+		loadMockProcFile("self/stat", "")
+		p := mockNew()
+		p.processTopN = 3
+		So(p.readProcStat(time.Now()), ShouldBeNil)
+		So(p.readProcesses(), ShouldBeNil)
+		So(p.readThreads(), ShouldBeNil)
+
+		Convey("threads should be ranked by total CPU time for the first collection", func() {
+			So(len(p.threadStats), ShouldEqual, 3)
+			So(p.threadStats, ShouldNotContainKey, "103")
+			So(p.threadTags["101"], ShouldResemble, map[string]string{commTag: "worker", pidTag: "100"})
+			val, err := getMapValueByNamespace(p.threadStats, []string{"101", threadCpusAllowed})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "1")
+			val, err = getMapValueByNamespace(p.threadStats, []string{"102", processProcessor})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 10)
+			val, err = getMapValueByNamespace(p.processStats, []string{"100", processCpusUsed})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("thread which exited while being read should be skipped", func() {
+			// reading stat of exited thread fails with error other than ENOENT (e.g. ESRCH)
+			loadMockProcFile("100/task/104/comm", "short-lived")
+			So(os.MkdirAll(filepath.Join(mockProcRoot, "100", "task", "104", "stat"), 0755), ShouldBeNil)
+			p.processTopN = 10
+			So(p.readThreads(), ShouldBeNil)
+			So(len(p.threadStats), ShouldEqual, 4)
+			So(p.threadStats, ShouldNotContainKey, "104")
+		})
+
+		Convey("threads should be attached to CPU on which they last ran", func() {
+			So(p.stats[secondCPU], ShouldContainKey, threadsGroup)
+			So(p.stats[secondCPU][threadsGroup], ShouldContainKey, "101")
+			So(p.stats[elevethCPU][threadsGroup], ShouldContainKey, "102")
+			So(p.stats[twelfthCPU], ShouldNotContainKey, threadsGroup)
+		})
+
+		Convey("CPU usage and number of CPUs used should be calculated since previous collection", func() {
+			loadMockCPUInfo(1)
+			// thread 100 ran on the same CPU as thread 101, thread 102 migrated to CPU 11
+			loadMockThread("100", "100", "nginx", 10, 11, 1, "0-1,10-11")
+			loadMockThread("100", "101", "worker", 11813, 200, 1, "1")
+			loadMockThread("100", "102", "worker", 490, 290, 11, "10-11")
+			loadMockThread("100", "103", "idle", 1131, 0, 11, "0-1,10-11")
+			So(p.readProcStat(time.Now()), ShouldBeNil)
+			So(p.readProcesses(), ShouldBeNil)
+			So(p.readThreads(), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.threadStats, []string{"101", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 1, 0.001)
+			val, err = getMapValueByNamespace(p.threadStats, []string{"103", processCPUPercentage})
+			So(err, ShouldBeNil)
+			So(val, ShouldAlmostEqual, 0.1, 0.001)
+			So(p.threadStats, ShouldNotContainKey, "102")
+			val, err = getMapValueByNamespace(p.processStats, []string{"100", processCpusUsed})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 2)
+			So(p.stats[elevethCPU], ShouldNotContainKey, threadsGroup)
+			So(p.stats[twelfthCPU][threadsGroup], ShouldContainKey, "103")
+		})
+
+		Convey("per-thread and per-CPU thread metrics should be collected with tags", func() {
+			p.processTopN = 4
+			loadMockCPUInfo(1)
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, threadLevel, "*", processUtime)},
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, secondCPU, threadsGroup, "*", processCPUPercentage)},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 5)
+			for _, m := range metrics {
+				So(m.Tags[pidTag], ShouldEqual, "100")
+				if m.Namespace.Strings()[3] == secondCPU {
+					So(m.Namespace.Strings()[5], ShouldEqual, "101")
+					So(m.Tags[commTag], ShouldEqual, "worker")
+				}
+			}
+		})
+
+		Convey("per-CPU thread metrics should be available", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/*/threads/*/cpu_percentage")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/thread/*/cpus_allowed")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/process/*/cpus_used")
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockProcRoot)
+		})
+	})
+}
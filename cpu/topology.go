@@ -0,0 +1,294 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	//nodeSysDir directory in sysfs with NUMA nodes
+	nodeSysDir = "devices/system/node"
+
+	//coreLevel namespace part for metrics aggregated per physical core (SMT siblings combined)
+	coreLevel = "core"
+
+	//socketLevel namespace part for metrics aggregated per package (socket)
+	socketLevel = "socket"
+
+	//nodeLevel namespace part for metrics aggregated per NUMA node
+	nodeLevel = "node"
+
+	//socketIDTag tag with identifier of package (socket) of CPU
+	socketIDTag = "socket_id"
+
+	//coreIDTag tag with identifier of physical core of CPU (unique within socket)
+	coreIDTag = "core_id"
+
+	//numaNodeTag tag with identifier of NUMA node of CPU
+	numaNodeTag = "numa_node"
+
+	//threadSiblingOfTag tag with identifier of the first CPU (hardware thread) of physical core of CPU
+	threadSiblingOfTag = "thread_sibling_of"
+
+	//clusterIDTag tag with identifier of cluster of CPU (e.g. arm64 clusters)
+	clusterIDTag = "cluster_id"
+)
+
+// topologyLevels namespace parts and descriptions of dynamic elements of topology aggregation levels
+var topologyLevels = map[string]dynamicElement{
+	coreLevel:   {"coreID", "ID of physical core in format <socket ID>_<core ID>"},
+	socketLevel: {"socketID", "ID of package (socket)"},
+	nodeLevel:   {"nodeID", "ID of NUMA node"},
+}
+
+// cpuTopology identifiers of physical core, socket, NUMA node and cluster of CPU
+// and identifier of the first thread sibling of CPU
+type cpuTopology struct {
+	core            string
+	socket          string
+	node            string
+	cluster         string
+	threadSiblingOf string
+}
+
+// topologySample previous sample of aggregated jiffies of topology group
+type topologySample struct {
+	cpus    string
+	sum     float64
+	jiffies map[string]float64
+	time    time.Time
+}
+
+// readTopology aggregates per-CPU jiffies held in stats per physical core, socket and NUMA node
+// and calculates percentages of aggregates; topology is read from sysfs again when set of online CPUs changes,
+// group with changed set of CPUs or with counter reset of any of its CPUs is re-baselined
+func (p *CPUCollector) readTopology() error {
+	if err := p.refreshTopology(); err != nil {
+		return err
+	}
+
+	// CPUs of every topology group
+	groups := map[string]map[string][]string{}
+	for level := range topologyLevels {
+		groups[level] = make(map[string][]string)
+	}
+	for cpuID, topology := range p.topology {
+		groups[coreLevel][topology.socket+"_"+topology.core] = append(groups[coreLevel][topology.socket+"_"+topology.core], cpuID)
+		groups[socketLevel][topology.socket] = append(groups[socketLevel][topology.socket], cpuID)
+		if topology.node != "" {
+			groups[nodeLevel][topology.node] = append(groups[nodeLevel][topology.node], cpuID)
+		}
+	}
+
+	prevTopology := p.prevTopology
+	p.prevTopology = make(map[string]topologySample)
+	p.topologyStats = make(map[string]map[string]interface{})
+	for level, levelGroups := range groups {
+		levelStats := make(map[string]interface{})
+		for id, cpuIDs := range levelGroups {
+			key := level + "/" + id
+			groupStats, sample, err := p.getTopologyGroupStats(cpuIDs, prevTopology[key])
+			if err != nil {
+				return err
+			}
+			levelStats[id] = groupStats
+			p.prevTopology[key] = sample
+		}
+		if len(levelStats) > 0 {
+			p.topologyStats[level] = levelStats
+		}
+	}
+	return nil
+}
+
+// getTopologyGroupStats sums jiffies of given CPUs and calculates percentages in the same way as getStats does
+// for single CPU (with the same percentage denominator), using previous sample of the group
+func (p *CPUCollector) getTopologyGroupStats(cpuIDs []string, prev topologySample) (map[string]interface{}, topologySample, error) {
+	sort.Strings(cpuIDs)
+	sample := topologySample{
+		cpus:    strings.Join(cpuIDs, ","),
+		jiffies: make(map[string]float64),
+		time:    p.procStatTime,
+	}
+	reset := false
+	for _, cpuID := range cpuIDs {
+		cpuStats := p.stats[cpuID]
+		for _, metricName := range p.snapMetricsNames {
+			val, err := getMapFloatValueByNamespace(cpuStats, []string{getNamespaceMetricPart(metricName, jiffiesRepresentationType)})
+			if err != nil {
+				return nil, sample, err
+			}
+			sample.jiffies[metricName] += val
+		}
+		reset = reset || cpuStats[counterResetMetric] == uint64(1)
+	}
+	for _, metricName := range p.procStatMetricsNames {
+		sample.sum += sample.jiffies[metricName]
+	}
+
+	groupStats := make(map[string]interface{})
+	opts := cpuTimesOptions{clkTck: p.clkTck, denominator: p.percentDenominator}
+	if !prev.time.IsZero() {
+		opts.elapsed = sample.time.Sub(prev.time).Seconds()
+	}
+	diffGuest := sample.jiffies[guestProcStat] + sample.jiffies[guestNiceProcStat] -
+		prev.jiffies[guestProcStat] - prev.jiffies[guestNiceProcStat]
+	denominator := getPercentageDenominator(opts, sample.sum-prev.sum, diffGuest, len(cpuIDs))
+	comparable := prev.cpus == sample.cpus && !reset && denominator > 0
+	for metricName, val := range sample.jiffies {
+		groupStats[getNamespaceMetricPart(metricName, jiffiesRepresentationType)] = val
+		groupStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = nil
+		if comparable {
+			diffVal := val - prev.jiffies[metricName]
+			if p.percentDenominator != percentageDenominatorSum && isGuestCountedTwice(metricName) {
+				diffVal -= diffGuest
+			}
+			if percVal := 100 * diffVal / denominator; percVal >= 0 {
+				groupStats[getNamespaceMetricPart(metricName, percentageRepresentationType)] = percVal
+			}
+		}
+	}
+	setSeconds(groupStats, p.snapMetricsNames, p.clkTck)
+	return groupStats, sample, nil
+}
+
+// refreshTopology reads topology of online CPUs from sysfs if set of online CPUs has changed since previous read
+func (p *CPUCollector) refreshTopology() error {
+	cpuIDs := p.getOnlineCPUs()
+	onlineCPUs := strings.Join(cpuIDs, ",")
+	if p.topology != nil && onlineCPUs == p.topologyCPUs {
+		return nil
+	}
+
+	topology, err := getTopology(p.sys_path, cpuIDs)
+	if err != nil {
+		return err
+	}
+	p.topology = topology
+	p.topologyCPUs = onlineCPUs
+	return nil
+}
+
+// getTopology reads identifiers of physical core and socket of given CPUs from
+// /sys/devices/system/cpu/cpuN/topology and NUMA nodes of CPUs from /sys/devices/system/node/nodeN/cpulist;
+// CPUs without topology information are omitted
+func getTopology(sysPath string, cpuIDs []string) (map[string]cpuTopology, error) {
+	nodes, err := getNodes(sysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := make(map[string]cpuTopology)
+	for _, cpuID := range cpuIDs {
+		dir := filepath.Join(sysPath, cpuSysDir, cpuStr+cpuID, "topology")
+		socket, err := readStringFile(filepath.Join(dir, "physical_package_id"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		core, err := readStringFile(filepath.Join(dir, "core_id"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		cluster, err := readStringFile(filepath.Join(dir, "cluster_id"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		siblings, err := getCPUList(filepath.Join(dir, "thread_siblings_list"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		threadSiblingOf := ""
+		if len(siblings) > 0 {
+			threadSiblingOf = siblings[0]
+		}
+		topology[cpuID] = cpuTopology{
+			core:            core,
+			socket:          socket,
+			node:            nodes[cpuID],
+			cluster:         cluster,
+			threadSiblingOf: threadSiblingOf,
+		}
+	}
+	return topology, nil
+}
+
+// getTopologyTags returns topology tags of CPU with given identifier, tags with unknown values are omitted;
+// nil is returned for CPUs without topology information (e.g. "all")
+func (p *CPUCollector) getTopologyTags(cpuID string) map[string]string {
+	topology, ok := p.topology[cpuID]
+	if !ok {
+		return nil
+	}
+	tags := map[string]string{
+		socketIDTag: topology.socket,
+		coreIDTag:   topology.core,
+	}
+	if topology.node != "" {
+		tags[numaNodeTag] = topology.node
+	}
+	if topology.threadSiblingOf != "" {
+		tags[threadSiblingOfTag] = topology.threadSiblingOf
+	}
+	if topology.cluster != "" {
+		tags[clusterIDTag] = topology.cluster
+	}
+	return tags
+}
+
+// getNodes reads list of CPUs of every NUMA node and returns map of NUMA node identifiers
+// with CPU identifier as key, empty map is returned for systems without NUMA support
+func getNodes(sysPath string) (map[string]string, error) {
+	nodes := make(map[string]string)
+	entries, err := ioutil.ReadDir(filepath.Join(sysPath, nodeSysDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nodes, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		nodeID := strings.TrimPrefix(entry.Name(), nodeLevel)
+		if nodeID == entry.Name() || nodeID == "" || strings.Trim(nodeID, "0123456789") != "" {
+			continue
+		}
+		cpuIDs, err := getCPUList(filepath.Join(sysPath, nodeSysDir, entry.Name(), "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		for _, cpuID := range cpuIDs {
+			nodes[cpuID] = nodeID
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,234 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// loadMockTopology writes mocked topology of CPUs 0, 1 (socket 0, node 0, cluster 4) and 10, 11 (socket 1, node 1),
+// CPUs on the same socket are SMT siblings of one physical core
+func loadMockTopology() {
+	for _, cpuID := range []string{firstCPU, secondCPU} {
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/physical_package_id", "0\n")
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/core_id", "0\n")
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/thread_siblings_list", "0-1\n")
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/cluster_id", "4\n")
+	}
+	for _, cpuID := range []string{elevethCPU, twelfthCPU} {
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/physical_package_id", "1\n")
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/core_id", "0\n")
+		loadMockSysFile(cpuSysDir+"/cpu"+cpuID+"/topology/thread_siblings_list", "10,11\n")
+	}
+	loadMockSysFile(nodeSysDir+"/node0/cpulist", "0-1\n")
+	loadMockSysFile(nodeSysDir+"/node1/cpulist", "10-11\n")
+	loadMockSysFile(nodeSysDir+"/possible", "0-1\n")
+}
+
+func (cis *CPUInfoSuite) TestTopology() {
+	Convey("Given cpu plugin initialized with mocked topology", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockTopology()
+		p := mockNew()
+		ts := time.Now()
+		So(p.readProcStat(ts), ShouldBeNil)
+		So(p.readTopology(), ShouldBeNil)
+
+		Convey("CPUs should be grouped per core, socket and NUMA node", func() {
+			So(p.topologyStats[coreLevel], ShouldContainKey, "0_0")
+			So(p.topologyStats[coreLevel], ShouldContainKey, "1_0")
+			So(len(p.topologyStats[coreLevel]), ShouldEqual, 2)
+			So(p.topologyStats[socketLevel], ShouldContainKey, "0")
+			So(p.topologyStats[socketLevel], ShouldContainKey, "1")
+			So(p.topologyStats[nodeLevel], ShouldContainKey, "0")
+			So(p.topologyStats[nodeLevel], ShouldContainKey, "1")
+			So(len(p.topologyStats[nodeLevel]), ShouldEqual, 2)
+		})
+
+		Convey("jiffies should be summed and percentages should not be available for the first sample", func() {
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", getNamespaceMetricPart(userProcStat, jiffiesRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 3464284+3501681)
+			val, err = getMapValueByNamespace(p.topologyStats[nodeLevel], []string{"1", getNamespaceMetricPart(idleProcStat, jiffiesRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 49355234+49374240)
+			val, err = getMapValueByNamespace(p.topologyStats[coreLevel], []string{"0_0", getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("percentages should be calculated from aggregated jiffies for the next sample", func() {
+			loadMockCPUInfo(1)
+			So(p.readProcStat(ts.Add(time.Second)), ShouldBeNil)
+			So(p.readTopology(), ShouldBeNil)
+
+			prevSum := 3464284.0 + 998669 + 208226 + 49355234 + 57380 + 3 + 422 +
+				3501681 + 1012206 + 189642 + 49374240 + 11620 + 0 + 278
+			currSum := 3480506.0 + 1005574 + 209103 + 49472588 + 57381 + 3 + 424 +
+				3516068 + 1019269 + 190413 + 49493320 + 11620 + 0 + 278
+			expected := 100 * (3480506 + 3516068 - 3464284 - 3501681) / (currSum - prevSum)
+			for _, level := range []string{coreLevel, socketLevel, nodeLevel} {
+				for id := range p.topologyStats[level] {
+					val, err := getMapValueByNamespace(p.topologyStats[level], []string{id, getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+					So(err, ShouldBeNil)
+					So(val, ShouldAlmostEqual, expected)
+				}
+			}
+		})
+
+		Convey("group with changed set of CPUs should be re-baselined", func() {
+			loadMockCPUInfo(hotplugCpuStatIndex)
+			So(p.readProcStat(ts.Add(time.Second)), ShouldBeNil)
+			So(p.readTopology(), ShouldBeNil)
+
+			val, err := getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", getNamespaceMetricPart(userProcStat, jiffiesRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, 3480506)
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"0", getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			val, err = getMapValueByNamespace(p.topologyStats[socketLevel], []string{"1", getNamespaceMetricPart(userProcStat, percentageRepresentationType)})
+			So(err, ShouldBeNil)
+			So(val, ShouldNotBeNil)
+		})
+
+		Convey("aggregated metrics should be available with dynamic topology elements", func() {
+			mts, err := p.GetMetricTypes(plugin.Config{})
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, m := range mts {
+				namespaces = append(namespaces, m.Namespace.String())
+				if m.Namespace.Strings()[3] == socketLevel {
+					So(m.Namespace[4].Name, ShouldEqual, "socketID")
+				}
+			}
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/core/*/user_percentage")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/socket/*/idle_jiffies")
+			So(namespaces, ShouldContain, "/intel/procfs/cpu/node/*/system_percentage")
+		})
+
+		Convey("aggregated metrics should be collected", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, socketLevel, "*", getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))},
+			}
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			for _, m := range metrics {
+				So(m.Namespace.Strings()[3], ShouldEqual, socketLevel)
+				So(m.Data, ShouldEqual, 3464284+3501681)
+			}
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
+
+func (cis *CPUInfoSuite) TestTopologyTags() {
+	Convey("Given cpu plugin initialized with mocked topology", cis.T(), func() {
+		loadMockCPUInfo(0)
+		loadMockTopology()
+		p := mockNew()
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace(vendor, fs, Name, "*", getNamespaceMetricPart(userProcStat, jiffiesRepresentationType))},
+		}
+
+		Convey("per-CPU metrics should be tagged with topology of CPU", func() {
+			metrics, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 5)
+			for _, m := range metrics {
+				switch m.Namespace.Strings()[3] {
+				case secondCPU:
+					So(m.Tags, ShouldResemble, map[string]string{
+						socketIDTag:        "0",
+						coreIDTag:          "0",
+						numaNodeTag:        "0",
+						threadSiblingOfTag: "0",
+						clusterIDTag:       "4",
+					})
+				case twelfthCPU:
+					So(m.Tags, ShouldResemble, map[string]string{
+						socketIDTag:        "1",
+						coreIDTag:          "0",
+						numaNodeTag:        "1",
+						threadSiblingOfTag: "10",
+					})
+				case allCPU:
+					So(m.Tags, ShouldBeNil)
+				}
+			}
+		})
+
+		Convey("topology tags should be merged with tags of interrupts", func() {
+			loadMockProcFile(interruptsFile, `           CPU0       CPU1       CPU10      CPU11
+  0:         36          0          0          0   IO-APIC   2-edge      timer`)
+			metrics, err := p.CollectMetrics([]plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, fs, Name, elevethCPU, interruptsGroup, "0", interruptsCount)},
+			})
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Tags[socketIDTag], ShouldEqual, "1")
+			So(metrics[0].Tags[chipTag], ShouldEqual, "IO-APIC")
+			So(p.interruptsTags["0"], ShouldNotContainKey, socketIDTag)
+		})
+
+		Convey("topology tags should be refreshed when CPU goes offline", func() {
+			_, err := p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(p.topology, ShouldContainKey, secondCPU)
+			loadMockCPUInfo(hotplugCpuStatIndex)
+			_, err = p.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(p.topology, ShouldNotContainKey, secondCPU)
+			So(p.topology, ShouldContainKey, firstCPU)
+		})
+
+		Convey("per-CPU metrics should not be tagged when topology tagging is disabled", func() {
+			q := New()
+			q.proc_path = mockPath
+			q.proc_root = mockProcRoot
+			q.sys_path = mockSysRoot
+			cfg := plugin.Config{"topology_tags": false}
+			So(q.init(cfg), ShouldBeNil)
+			So(q.topologyTags, ShouldBeFalse)
+			metrics, err := q.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			for _, m := range metrics {
+				So(m.Tags, ShouldBeNil)
+			}
+		})
+
+		Reset(func() {
+			loadMockCPUInfo(defaultFormatCpuStatIndex)
+			os.RemoveAll(mockProcRoot)
+			os.RemoveAll(mockSysRoot)
+		})
+	})
+}
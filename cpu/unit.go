@@ -0,0 +1,121 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//unitDimensionless unit of counts, ratios and identifiers
+	unitDimensionless = "1"
+
+	//unitString unit of metrics with textual value (e.g. model name, governor)
+	unitString = "string"
+)
+
+// metricUnits units of metrics which name does not end with suffix listed in metricUnitSuffixes
+var metricUnits = map[string]string{
+	rateRepresentationType:      "1/s",
+	processUtime:                "jiffies",
+	processStime:                "jiffies",
+	processGuestTime:            "jiffies",
+	schedstatRunTime:            "ns",
+	schedstatWaitTime:           "ns",
+	schedstatRunTime + "_rate":  "s/s",
+	schedstatWaitTime + "_rate": "s/s",
+	cgroupThrottledRate:         "us/s",
+	cstateTime:                  "us",
+	"latency":                   "us",
+	"scaling_cur_freq":          "kHz",
+	"cpuinfo_min_freq":          "kHz",
+	"cpuinfo_max_freq":          "kHz",
+	"mhz":                       "MHz",
+	"cache_size":                "KB",
+	btimeProcStat:               "s",
+	packageTemperature:          "Cel",
+}
+
+// metricUnitSuffixes units of metrics by suffix of metric name
+var metricUnitSuffixes = []struct {
+	suffix string
+	unit   string
+}{
+	{"_" + jiffiesRepresentationType, "jiffies"},
+	{"_" + secondsRepresentationType, "s"},
+	{"_" + percentageRepresentationType, "%"},
+	{"_" + rateRepresentationType, "1/s"},
+	{"_usec", "us"},
+	{"_ms", "ms"},
+	{raplPowerSuffix, "W"},
+	{"_avg10", "%"},
+	{"_avg60", "%"},
+	{"_avg300", "%"},
+}
+
+// getUnit returns unit of collected metric with given namespace and value
+func getUnit(ns plugin.Namespace, data interface{}) string {
+	if _, ok := data.(string); ok {
+		return unitString
+	}
+	for _, element := range ns {
+		// time spent in frequency, namespace ends with dynamic frequency
+		if element.Value == timeInState {
+			return "10ms"
+		}
+	}
+	metricName := ns[len(ns)-1].Value
+	if strings.HasPrefix(metricName, pressurePrefix) && strings.HasSuffix(metricName, "_total") {
+		return "us"
+	}
+	if unit, ok := metricUnits[metricName]; ok {
+		return unit
+	}
+	// rates of CPU times are reported only per CPU, system-wide softirq_rate is number of softirqs per second
+	if len(ns) == minNamespaceSize && ns[3].Value != systemStats && isCPUTimeRate(metricName) {
+		return "s/s"
+	}
+	for _, suffix := range metricUnitSuffixes {
+		if strings.HasSuffix(metricName, suffix.suffix) {
+			return suffix.unit
+		}
+	}
+	return unitDimensionless
+}
+
+// isCPUTimeRate checks if metric is rate of CPU time read from /proc/stat (CPU-seconds per second)
+func isCPUTimeRate(metricName string) bool {
+	if !strings.HasSuffix(metricName, "_"+rateRepresentationType) {
+		return false
+	}
+	name := strings.TrimSuffix(metricName, "_"+rateRepresentationType)
+	for _, names := range [][]string{cpuProcStatMetricsNames, snapSpecificMetricsNames} {
+		for _, cpuTime := range names {
+			if name == cpuTime {
+				return true
+			}
+		}
+	}
+	return false
+}
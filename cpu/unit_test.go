@@ -0,0 +1,59 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (cis *CPUInfoSuite) TestGetUnit() {
+	Convey("Given namespaces of collected metrics", cis.T(), func() {
+		unit := func(data interface{}, ns ...string) string {
+			return getUnit(plugin.NewNamespace(append([]string{vendor, fs, Name}, ns...)...), data)
+		}
+		So(unit(1.0, firstCPU, "user_jiffies"), ShouldEqual, "jiffies")
+		So(unit(1.0, firstCPU, "user_seconds"), ShouldEqual, "s")
+		So(unit(1.0, firstCPU, "user_percentage"), ShouldEqual, "%")
+		So(unit(uint64(1), firstCPU, counterResetMetric), ShouldEqual, unitDimensionless)
+		So(unit(1.0, firstCPU, "user_rate"), ShouldEqual, "s/s")
+		So(unit(1.0, allCPU, "softirq_rate"), ShouldEqual, "s/s")
+		So(unit(1.0, systemStats, "ctxt_rate"), ShouldEqual, "1/s")
+		So(unit(1.0, systemStats, "softirq_rate"), ShouldEqual, "1/s")
+		So(unit(uint64(1), systemStats, btimeProcStat), ShouldEqual, "s")
+		So(unit(1.0, systemStats, "pressure_some_avg10"), ShouldEqual, "%")
+		So(unit(uint64(1), systemStats, "pressure_full_total"), ShouldEqual, "us")
+		So(unit(1.0, firstCPU, interruptsGroup, "0", rateRepresentationType), ShouldEqual, "1/s")
+		So(unit(uint64(1), firstCPU, cpufreqGroup, timeInState, "2400000"), ShouldEqual, "10ms")
+		So(unit(uint64(1), firstCPU, cpuidleGroup, "state1", cstateTime), ShouldEqual, "us")
+		So(unit(1.0, firstCPU, cpuidleGroup, "state1", "time_percentage"), ShouldEqual, "%")
+		So(unit("C1E", firstCPU, cpuidleGroup, "state1", cstateName), ShouldEqual, unitString)
+		So(unit(uint64(1), cgroupLevel, "system.slice", "throttled_usec"), ShouldEqual, "us")
+		So(unit(1.0, cgroupLevel, "system.slice", cgroupThrottledRate), ShouldEqual, "us/s")
+		So(unit(uint64(1), firstCPU, schedstatGroup, schedstatWaitTime), ShouldEqual, "ns")
+		So(unit(1.0, firstCPU, schedstatGroup, "wait_time_rate"), ShouldEqual, "s/s")
+		So(unit(uint64(1), firstCPU, thermalGroup, "core_throttle_total_time_ms"), ShouldEqual, "ms")
+		So(unit(1.0, socketLevel, "0", "package_power"), ShouldEqual, "W")
+		So(unit(1.0, socketLevel, "0", packageTemperature), ShouldEqual, "Cel")
+		So(unit(uint64(1), processLevel, "1", processUtime), ShouldEqual, "jiffies")
+	})
+}
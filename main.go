@@ -22,11 +22,99 @@ limitations under the License.
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/intelsdi-x/snap-plugin-collector-cpu/cpu"
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
 
+const (
+	// exporterCommand first argument which starts plugin as standalone Prometheus exporter instead of Snap collector
+	exporterCommand = "exporter"
+
+	// collectCommand first argument which starts plugin in one-shot CLI mode printing collected metrics
+	collectCommand = "collect"
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == exporterCommand {
+		startExporter(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == collectCommand {
+		collectOnce(os.Args[2:])
+		return
+	}
 	plugin.StartCollector(cpu.New(), cpu.Name, cpu.Version, plugin.ConcurrencyCount(1))
 
 }
+
+// startExporter serves metrics in OpenMetrics text format on /metrics endpoint,
+// configuration items of the plugin are given as flags
+func startExporter(args []string) {
+	flags := flag.NewFlagSet(exporterCommand, flag.ExitOnError)
+	listenAddress := flags.String("listen-address", ":9101", "address on which metrics are served")
+	config := addConfigFlags(flags)
+	flags.Parse(args)
+
+	http.Handle("/metrics", cpu.NewExporter(cpu.New(), config()))
+	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+}
+
+// collectOnce collects metrics twice with given interval and prints metrics of the second collection
+// which namespace matches any of given globs to standard output
+func collectOnce(args []string) {
+	flags := flag.NewFlagSet(collectCommand, flag.ExitOnError)
+	interval := flags.Duration("interval", time.Second, "interval between two collections")
+	format := flags.String("format", cpu.FormatTable, "output format: "+strings.Join([]string{cpu.FormatJSON, cpu.FormatCSV, cpu.FormatTable}, ", "))
+	filter := flags.String("filter", "", "comma separated list of namespace globs (e.g. /intel/procfs/cpu/*/user_percentage)")
+	config := addConfigFlags(flags)
+	flags.Parse(args)
+
+	globs := []string{}
+	if *filter != "" {
+		globs = strings.Split(*filter, ",")
+	}
+	metrics, err := cpu.CollectOnce(cpu.New(), config(), *interval, globs, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cpu.WriteMetrics(os.Stdout, metrics, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// addConfigFlags adds flags with configuration items of the plugin to flags,
+// returned function builds plugin configuration when flags are parsed
+func addConfigFlags(flags *flag.FlagSet) func() plugin.Config {
+	procPath := flags.String("proc_path", cpu.DefaultProcPath, "path to procfs")
+	sysPath := flags.String("sys_path", cpu.DefaultSysPath, "path to sysfs")
+	cgroupPath := flags.String("cgroup_path", cpu.DefaultCgroupPath, "path to root of cgroup hierarchy")
+	topologyTags := flags.Bool("topology_tags", cpu.DefaultTopologyTags, "tag per-CPU metrics with CPU topology")
+	processTopN := flags.Int64("process_top_n", cpu.DefaultProcessTopN, "number of processes with the highest CPU usage which are reported")
+	processInclude := flags.String("process_include", "", "regular expression matched against command name of processes to scan")
+	processExclude := flags.String("process_exclude", "", "regular expression matched against command name of processes not to scan")
+	clkTck := flags.Int64("clk_tck", 0, "frequency of clock ticks used to convert jiffies to seconds (detected if 0)")
+	percentageDenominator := flags.String("percentage_denominator", cpu.DefaultPercentageDenominator, "denominator of percentages of CPU times: sum_without_guest, sum, elapsed")
+	return func() plugin.Config {
+		return plugin.Config{
+			"proc_path":              *procPath,
+			"sys_path":               *sysPath,
+			"cgroup_path":            *cgroupPath,
+			"topology_tags":          *topologyTags,
+			"process_top_n":          *processTopN,
+			"process_include":        *processInclude,
+			"process_exclude":        *processExclude,
+			"clk_tck":                *clkTck,
+			"percentage_denominator": *percentageDenominator,
+		}
+	}
+}